@@ -7,11 +7,15 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"nc/model"
 	"nc/util"
+	"net"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -29,6 +33,56 @@ var (
 	ipv6Only    bool
 	scan        string
 	jobs        int
+	execProgram string
+	shellExec   string
+	hexDump     string
+	proxyAddr   string
+	proxyType   string
+	proxyAuth   string
+	unixSock    bool
+	seqPacket   bool
+	unixMode    string
+	telnet      bool
+	sslEnabled  bool
+	sslCert     string
+	sslKey      string
+	sslVerify   bool
+	sslTrust    string
+	sslServer   string
+	sslALPN     string
+	sslClientCA string
+	sslAllow    []string
+	brokerMode  bool
+	chatMode    bool
+	stdinPolicy string
+	udpIdle     int
+	iface       string
+	allowList   []string
+	denyList    []string
+	allowFiles  []string
+	denyFiles   []string
+	halfClose   bool
+	quitAfter   int
+	sendFile    string
+	recvDir     string
+	sendDir     string
+	extractDir  string
+	compress    string
+	stats       bool
+	statsJSON   bool
+	rateLimit   string
+	interval    float64
+	crlf        bool
+	stripCR     bool
+	scanFormat  string
+	scanOutput  string
+	hostsFiles  []string
+	excludeHost []string
+	banner      bool
+	bannerProbe string
+	service     bool
+	serviceDBs  []string
+	udpPayloads []string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -44,14 +98,73 @@ var rootCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		opts, err := buildOptions()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
 		// Scan ports
 		if scan != "" {
-			host, ports, err := parseScanPort(args, scan)
+			hosts, err := readHostsFiles(hostsFiles)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			// Hosts from --hosts-file come before the ones on the command line.
+			targets, ports, err := parseScanPort(append(hosts, args...), scan)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			hosts, err = model.ExpandTargets(targets, excludeHost)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if unixSock {
+				fmt.Println("cannot combine -z and -U")
+				os.Exit(1)
+			}
+			scanOpts, err := buildScanOptions(opts)
 			if err != nil {
 				fmt.Println(err.Error())
 				os.Exit(1)
 			}
-			if err := model.Scan(host, ports, verbose, udp, idleSeconds, port, jobs, ipMode); err != nil {
+			err = model.Scan(hosts, ports, verbose, udp, idleSeconds, port, jobs, ipMode, scanOpts)
+			if closer, ok := scanOpts.Output.(io.Closer); ok {
+				_ = closer.Close()
+			}
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+
+		if scanOutput != "" || cmd.Flags().Changed("output-format") || len(hostsFiles) > 0 || len(excludeHost) > 0 || banner || bannerProbe != "" || service || len(serviceDBs) > 0 || len(udpPayloads) > 0 {
+			fmt.Println("-o, --output-format, --hosts-file, --exclude, --banner, --service and --udp-payload require -z")
+			os.Exit(1)
+		}
+
+		// Unix domain socket mode, the only positional argument is the socket path
+		if unixSock {
+			opts.Unix, err = parseUnixSocket(args, udp, seqPacket, unixMode)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if err := openHexDump(&opts); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if listen {
+				err = model.Listen(0, verbose, udp, acceptLoop, source, ipMode, opts)
+			} else {
+				err = model.ConnectWithTimer("", "", verbose, udp, idleSeconds, numeric_ip, ipMode, opts)
+			}
+			closeHexDump(opts, err)
+			if err != nil {
 				fmt.Println(err.Error())
 				os.Exit(1)
 			}
@@ -60,12 +173,24 @@ var rootCmd = &cobra.Command{
 
 		// -l flag for listen mode
 		if listen {
-			listenPort, err := parseListenPort(args, port)
+			bindHost, listenPort, err := parseListenAddr(args, port)
 			if err != nil {
 				fmt.Println(err.Error())
 				os.Exit(1)
 			}
-			if err := model.Listen(listenPort, verbose, udp, acceptLoop, source, ipMode); err != nil {
+			opts.BindHost = bindHost
+			opts.Access, err = buildAccessList(ipMode)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if err := openHexDump(&opts); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			err = model.Listen(listenPort, verbose, udp, acceptLoop, source, ipMode, opts)
+			closeHexDump(opts, err)
+			if err != nil {
 				fmt.Println(err.Error())
 			}
 			return
@@ -75,7 +200,14 @@ var rootCmd = &cobra.Command{
 		if len(args) == 2 {
 			host := args[0]
 			portStr := args[1]
-			err := model.ConnectWithTimer(host, portStr, verbose, udp, idleSeconds, numeric_ip, ipMode)
+			opts.SourceAddr = source
+			opts.SourcePort = port
+			if err := openHexDump(&opts); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			err := model.ConnectWithTimer(host, portStr, verbose, udp, idleSeconds, numeric_ip, ipMode, opts)
+			closeHexDump(opts, err)
 			if err != nil {
 				fmt.Println(err.Error())
 				os.Exit(1)
@@ -124,44 +256,569 @@ func init() {
 	rootCmd.Flags().BoolVarP(&ipv6Only, "ipv6", "6", false, "IPv6 only")
 	rootCmd.Flags().StringVarP(&scan, "scan", "z", "", "Scan a range of ports, [start]:[end], or 80 443 22 ...")
 	rootCmd.Flags().IntVarP(&jobs, "jobs", "j", 3, "Number of concurrency for -z port scan")
+	rootCmd.Flags().StringArrayVar(&hostsFiles, "hosts-file", nil, "Read -z targets from a file, one per line (repeatable)")
+	rootCmd.Flags().StringArrayVar(&excludeHost, "exclude", nil, "Skip this host, IP, CIDR or range during -z (repeatable)")
+	rootCmd.Flags().BoolVar(&banner, "banner", false, "With -z, read and show what open TCP ports send first")
+	rootCmd.Flags().StringVar(&bannerProbe, "banner-probe", "", `With --banner, send this first, e.g. "HEAD / HTTP/1.0\r\n\r\n"`)
+	rootCmd.Flags().BoolVar(&service, "service", false, "With -z, identify the service and version behind open TCP ports")
+	rootCmd.Flags().StringArrayVar(&serviceDBs, "service-db", nil, "With -z, load extra service probes from a file (repeatable, implies --service)")
+	rootCmd.Flags().StringArrayVar(&udpPayloads, "udp-payload", nil, `With -z -u, also send PORTS:PAYLOAD, e.g. "9999:ping\n" (repeatable)`)
+	rootCmd.Flags().StringVar(&scanFormat, "output-format", "text", "Scan result format: text, json, csv, grepable or xml")
+	rootCmd.Flags().StringVarP(&scanOutput, "output", "o", "", "Write scan results to a file, progress still goes to the terminal")
+	rootCmd.Flags().StringVarP(&execProgram, "exec", "e", "", "Execute the given program for each connection")
+	rootCmd.Flags().StringVarP(&shellExec, "sh-exec", "c", "", "Execute the given command via /bin/sh for each connection")
+	rootCmd.Flags().StringVarP(&hexDump, "hex-dump", "x", "", "Dump traffic in hex to a file, use - for stderr")
+	rootCmd.Flags().BoolVar(&brokerMode, "broker", false, "Listen mode: relay data between all connected clients")
+	rootCmd.Flags().BoolVar(&chatMode, "chat", false, "Listen mode: broker that prefixes each line with the sender's address")
+	rootCmd.Flags().StringVar(&stdinPolicy, "stdin-policy", "broadcast", "With -k, who receives stdin: broadcast, latest or round-robin")
+	rootCmd.Flags().StringVar(&iface, "interface", "", "Listen mode: bind to a network interface by name (Linux only)")
+	rootCmd.Flags().StringArrayVar(&allowList, "allow", nil, "Listen mode: only accept peers in this CIDR, IP or hostname (repeatable)")
+	rootCmd.Flags().StringArrayVar(&denyList, "deny", nil, "Listen mode: reject peers in this CIDR, IP or hostname (repeatable)")
+	rootCmd.Flags().StringArrayVar(&allowFiles, "allow-file", nil, "Read --allow entries from a file, one per line (repeatable)")
+	rootCmd.Flags().StringArrayVar(&denyFiles, "deny-file", nil, "Read --deny entries from a file, one per line (repeatable)")
+	rootCmd.Flags().IntVar(&udpIdle, "udp-idle", 60, "With -u -l -k, seconds before an idle UDP peer session is dropped, 0 to keep forever")
+	rootCmd.Flags().BoolVarP(&halfClose, "shutdown", "N", false, "Shut down the sending side of the socket after EOF on stdin")
+	rootCmd.Flags().IntVarP(&quitAfter, "quit", "q", -1, "Quit this many seconds after EOF on stdin, negative waits for the peer")
+	rootCmd.Flags().StringVar(&sendFile, "send", "", "Send a file with name, size and SHA-256 header, resuming partial transfers")
+	rootCmd.Flags().StringVar(&recvDir, "recv", "", "Receive a file sent with --send into this directory")
+	rootCmd.Flags().StringVar(&sendDir, "send-dir", "", "Send the contents of a directory as a tar stream")
+	rootCmd.Flags().StringVar(&extractDir, "recv-dir", "", "Extract a tar stream sent with --send-dir into this directory")
+	rootCmd.Flags().StringVar(&compress, "compress", "none", "Compression for --send-dir: none, gzip or zstd (zstd needs the zstd command)")
+	rootCmd.Flags().BoolVar(&stats, "stats", false, "Show live bytes, rate and elapsed time on stderr, with a summary on close")
+	rootCmd.Flags().BoolVar(&statsJSON, "stats-json", false, "Print the connection summary on stderr as JSON")
+	rootCmd.Flags().StringVar(&rateLimit, "rate-limit", "", "Limit bytes per second as RATE or UP:DOWN, e.g. 64K or 1M:256K")
+	rootCmd.Flags().Float64VarP(&interval, "interval", "i", 0, "Seconds to wait between lines sent and between ports scanned")
+	rootCmd.Flags().BoolVarP(&crlf, "crlf", "C", false, "Send line endings as CRLF")
+	rootCmd.Flags().BoolVar(&stripCR, "strip-cr", false, "Turn CRLF line endings from the peer into LF")
+	rootCmd.Flags().BoolVarP(&telnet, "telnet", "t", false, "Answer telnet negotiation with refusals")
+	rootCmd.Flags().BoolVar(&sslEnabled, "ssl", false, "Connect or listen with TLS")
+	rootCmd.Flags().StringVar(&sslCert, "ssl-cert", "", "PEM certificate to present (a self-signed one is generated when listening without it)")
+	rootCmd.Flags().StringVar(&sslKey, "ssl-key", "", "PEM private key for --ssl-cert")
+	rootCmd.Flags().BoolVar(&sslVerify, "ssl-verify", false, "Verify the server certificate in connect mode")
+	rootCmd.Flags().StringVar(&sslTrust, "ssl-trustfile", "", "PEM CA bundle used to verify the peer (implies --ssl-verify)")
+	rootCmd.Flags().StringVar(&sslServer, "ssl-servername", "", "Server name to send via SNI and verify against")
+	rootCmd.Flags().StringVar(&sslALPN, "ssl-alpn", "", "Comma separated ALPN protocols, e.g. h2,http/1.1")
+	rootCmd.Flags().StringVar(&sslClientCA, "ssl-client-ca", "", "Require client certificates issued by this PEM CA bundle in listen mode")
+	rootCmd.Flags().StringArrayVar(&sslAllow, "ssl-allow", nil, "Only accept client certificates with this subject, CN or SAN (repeatable)")
+	rootCmd.Flags().StringVar(&proxyAddr, "proxy", "", "Connect through a proxy at host:port")
+	rootCmd.Flags().StringVar(&proxyType, "proxy-type", "http", "Proxy protocol: http, socks4, socks4a or socks5")
+	rootCmd.Flags().BoolVarP(&unixSock, "unixsock", "U", false, "Use a Unix domain socket path (or @name for an abstract socket) instead of host and port")
+	rootCmd.Flags().BoolVar(&seqPacket, "seqpacket", false, "Use a SOCK_SEQPACKET Unix socket with -U")
+	rootCmd.Flags().StringVar(&unixMode, "unix-mode", "", "Permissions for the Unix socket file in listen mode, e.g. 0660")
+	rootCmd.Flags().StringVar(&proxyAuth, "proxy-auth", "", "Proxy credentials as user:pass (user id only for socks4)")
+}
+
+// buildOptions collects the per-connection flags into model.Options.
+func buildOptions() (model.Options, error) {
+	opts := model.Options{
+		Telnet:    telnet,
+		Broker:    brokerMode,
+		Chat:      chatMode,
+		UDPIdle:   time.Duration(udpIdle) * time.Second,
+		Interface: iface,
+		HalfClose: halfClose,
+		QuitOnEOF: quitAfter >= 0,
+		QuitAfter: time.Duration(quitAfter) * time.Second,
+		StatsOut:  os.Stderr,
+		Interval:  time.Duration(interval * float64(time.Second)),
+		CRLF:      crlf,
+		StripCR:   stripCR,
+	}
+
+	if interval < 0 {
+		return opts, errors.New("interval cannot be negative")
+	}
+
+	switch {
+	case statsJSON:
+		opts.Stats = model.StatsJSON
+	case stats:
+		opts.Stats = model.StatsLive
+	}
+
+	switch {
+	case execProgram != "" && shellExec != "":
+		return opts, errors.New("cannot combine -e and -c")
+	case execProgram != "":
+		opts.Exec = execProgram
+	case shellExec != "":
+		opts.Exec = shellExec
+		opts.ShellExec = true
+	}
+
+	up, down, err := parseRateLimit(rateLimit)
+	if err != nil {
+		return opts, err
+	}
+	opts.RateUp, opts.RateDown = up, down
+
+	if err := parseTransfer(&opts); err != nil {
+		return opts, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(stdinPolicy)) {
+	case "broadcast", "":
+		opts.StdinPolicy = model.StdinBroadcast
+	case "latest":
+		opts.StdinPolicy = model.StdinLatest
+	case "round-robin", "roundrobin", "rr":
+		opts.StdinPolicy = model.StdinRoundRobin
+	default:
+		return opts, fmt.Errorf("unknown stdin policy %q", stdinPolicy)
+	}
+
+	proxy, err := parseProxy(proxyAddr, proxyType, proxyAuth)
+	if err != nil {
+		return opts, err
+	}
+	opts.Proxy = proxy
+
+	tlsOpts, err := parseTLS()
+	if err != nil {
+		return opts, err
+	}
+	opts.TLS = tlsOpts
+
+	return opts, nil
+}
+
+// openHexDump opens the -x target. It is called once every flag has been
+// checked, right before a connect or listen session; scans never dump traffic.
+func openHexDump(opts *model.Options) error {
+	switch hexDump {
+	case "":
+	case "-":
+		opts.HexDump = os.Stderr
+	default:
+		f, err := os.Create(hexDump)
+		if err != nil {
+			return fmt.Errorf("cannot open hex dump file: %w", err)
+		}
+		opts.HexDump = f
+	}
+	return nil
+}
+
+// closeHexDump closes the -x file once the session is over; stderr is left open.
+// A session that failed before any traffic leaves no empty dump behind.
+func closeHexDump(opts model.Options, runErr error) {
+	f, ok := opts.HexDump.(*os.File)
+	if !ok || f == os.Stderr {
+		return
+	}
+
+	info, statErr := f.Stat()
+	_ = f.Close()
+	if runErr != nil && statErr == nil && info.Size() == 0 {
+		_ = os.Remove(f.Name())
+	}
+}
+
+// buildScanOptions collects the flags that only apply to -z.
+func buildScanOptions(opts model.Options) (model.ScanOptions, error) {
+	scanOpts := model.ScanOptions{
+		Proxy:       opts.Proxy,
+		Interval:    opts.Interval,
+		Banner:      banner || bannerProbe != "",
+		BannerProbe: bannerProbe,
+		UDPPayloads: udpPayloads,
+	}
+
+	// --service-db adds probes to the built-in ones, so it implies --service.
+	if service || len(serviceDBs) > 0 {
+		db, err := model.NewServiceDB(serviceDBs...)
+		if err != nil {
+			return scanOpts, err
+		}
+		scanOpts.Services = db
+	}
+
+	format, err := parseScanFormat(scanFormat)
+	if err != nil {
+		return scanOpts, err
+	}
+	scanOpts.Format = format
+
+	if scanOutput != "" {
+		f, err := os.Create(scanOutput)
+		if err != nil {
+			return scanOpts, fmt.Errorf("cannot open output file: %w", err)
+		}
+		scanOpts.Output = f
+	}
+
+	return scanOpts, nil
+}
+
+// parseScanFormat maps --output-format to a model.ScanFormat.
+func parseScanFormat(name string) (model.ScanFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "text", "":
+		return model.ScanText, nil
+	case "json":
+		return model.ScanJSON, nil
+	case "csv":
+		return model.ScanCSV, nil
+	case "grepable", "grep":
+		return model.ScanGrepable, nil
+	case "xml":
+		return model.ScanXML, nil
+	default:
+		return model.ScanText, fmt.Errorf("unknown output format %q", name)
+	}
+}
+
+// parseRateLimit reads --rate-limit as a single rate for both directions or
+// UP:DOWN, where an empty side is unlimited.
+func parseRateLimit(spec string) (int64, int64, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 0, 0, nil
+	}
+
+	upStr, downStr, split := strings.Cut(spec, ":")
+	if !split {
+		downStr = upStr
+	}
+
+	up, err := parseByteRate(upStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	down, err := parseByteRate(downStr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return up, down, nil
+}
+
+// parseByteRate parses a byte count with an optional K, M or G (1024-based) suffix.
+func parseByteRate(raw string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	if s == "" {
+		return 0, nil
+	}
+
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/S"), "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+		return 0, fmt.Errorf("invalid rate %q", raw)
+	}
+
+	// float64(math.MaxInt64) rounds up to 2^63, which no longer fits.
+	bytes := value * float64(multiplier)
+	if bytes >= float64(math.MaxInt64) {
+		return 0, fmt.Errorf("invalid rate %q: too large", raw)
+	}
+	// Zero would mean unlimited, the opposite of what a tiny rate asks for.
+	if bytes < 1 {
+		return 0, fmt.Errorf("invalid rate %q: must be at least 1 byte per second", raw)
+	}
+
+	return int64(bytes), nil
 }
 
-func parseListenPort(args []string, flagPort int) (int, error) {
+// parseTransfer validates the --send, --recv, --send-dir and --recv-dir flags.
+func parseTransfer(opts *model.Options) error {
+	modes := 0
+	for _, v := range []string{sendFile, recvDir, sendDir, extractDir} {
+		if v != "" {
+			modes++
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(compress)) {
+	case "none", "":
+		opts.Compression = model.CompressNone
+	case "gzip", "gz":
+		opts.Compression = model.CompressGzip
+	case "zstd", "zst":
+		opts.Compression = model.CompressZstd
+	default:
+		return fmt.Errorf("unknown compression %q", compress)
+	}
+	if opts.Compression != model.CompressNone && sendDir == "" {
+		return errors.New("--compress requires --send-dir")
+	}
+
+	if modes == 0 {
+		return nil
+	}
+
+	switch {
+	case modes > 1:
+		return errors.New("use only one of --send, --recv, --send-dir and --recv-dir")
+	case opts.Exec != "":
+		return errors.New("cannot combine file transfer with -e/-c")
+	case brokerMode || chatMode:
+		return errors.New("cannot combine file transfer with broker mode")
+	case crlf || stripCR:
+		return errors.New("cannot combine file transfer with line ending translation")
+	}
+
+	for flag, dir := range map[string]string{"--recv": recvDir, "--recv-dir": extractDir} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s target %q is not a directory", flag, dir)
+		}
+	}
+
+	opts.SendFile = sendFile
+	opts.RecvDir = recvDir
+	opts.SendDir = sendDir
+	opts.ExtractDir = extractDir
+
+	return nil
+}
+
+// parseTLS collects the --ssl flags. It returns nil when TLS is not enabled.
+func parseTLS() (*model.TLSOptions, error) {
+	if !sslEnabled {
+		if sslCert != "" || sslKey != "" || sslVerify || sslTrust != "" || sslServer != "" || sslALPN != "" ||
+			sslClientCA != "" || len(sslAllow) > 0 {
+			return nil, errors.New("--ssl-* options require --ssl")
+		}
+		return nil, nil
+	}
+
+	if (sslCert == "") != (sslKey == "") {
+		return nil, errors.New("--ssl-cert and --ssl-key must be used together")
+	}
+	if len(sslAllow) > 0 && sslClientCA == "" {
+		return nil, errors.New("--ssl-allow requires --ssl-client-ca")
+	}
+
+	tlsOpts := &model.TLSOptions{
+		ServerName:   sslServer,
+		CAFile:       sslTrust,
+		Verify:       sslVerify || sslTrust != "",
+		CertFile:     sslCert,
+		KeyFile:      sslKey,
+		ClientCAFile: sslClientCA,
+		AllowedPeers: sslAllow,
+		// -w also bounds how long a listener waits for a client's handshake.
+		HandshakeTimeout: time.Duration(idleSeconds) * time.Second,
+	}
+
+	for _, proto := range strings.Split(sslALPN, ",") {
+		if proto = strings.TrimSpace(proto); proto != "" {
+			tlsOpts.ALPN = append(tlsOpts.ALPN, proto)
+		}
+	}
+
+	return tlsOpts, nil
+}
+
+// parseUnixSocket builds the -U endpoint from the socket path argument.
+func parseUnixSocket(args []string, datagram, packet bool, mode string) (*model.UnixSocket, error) {
+	if len(args) == 0 {
+		return nil, errors.New("-U missing socket path, use -h for help")
+	}
+	if len(args) > 1 {
+		return nil, errors.New("-U takes a single socket path, use -h for help")
+	}
+
+	sock := &model.UnixSocket{Path: args[0], Type: "unix"}
+
+	switch {
+	case datagram && packet:
+		return nil, errors.New("cannot combine -u and --seqpacket")
+	case datagram:
+		sock.Type = "unixgram"
+	case packet:
+		sock.Type = "unixpacket"
+	}
+
+	if mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || perm > 0o777 {
+			return nil, fmt.Errorf("invalid socket mode %q", mode)
+		}
+		sock.Mode = os.FileMode(perm)
+	}
+
+	return sock, nil
+}
+
+// parseProxy validates the --proxy flags. It returns nil when no proxy is set.
+func parseProxy(addr, proxyKind, auth string) (*model.Proxy, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil || host == "" {
+		return nil, errors.New("invalid proxy address, expected host:port")
+	}
+	if _, err := util.PortCheck(portStr); err != nil {
+		return nil, fmt.Errorf("invalid proxy port: %w", err)
+	}
+
+	proxy := &model.Proxy{Address: net.JoinHostPort(host, portStr)}
+
+	switch strings.ToLower(strings.TrimSpace(proxyKind)) {
+	case "http", "":
+		proxy.Type = model.ProxyHTTP
+	case "socks4":
+		proxy.Type = model.ProxySOCKS4
+	case "socks4a":
+		proxy.Type = model.ProxySOCKS4A
+	case "socks5":
+		proxy.Type = model.ProxySOCKS5
+	default:
+		return nil, fmt.Errorf("unknown proxy type %q", proxyKind)
+	}
+
+	if auth != "" {
+		user, pass, _ := strings.Cut(auth, ":")
+		proxy.Username = user
+		proxy.Password = pass
+	}
+
+	return proxy, nil
+}
+
+// buildAccessList merges --allow/--deny entries with those read from list files.
+// It returns nil when no rules are given.
+func buildAccessList(ipMode model.IPMode) (*model.AccessList, error) {
+	allow := append([]string(nil), allowList...)
+	deny := append([]string(nil), denyList...)
+
+	for _, path := range allowFiles {
+		entries, err := readListFile(path)
+		if err != nil {
+			return nil, err
+		}
+		allow = append(allow, entries...)
+	}
+	for _, path := range denyFiles {
+		entries, err := readListFile(path)
+		if err != nil {
+			return nil, err
+		}
+		deny = append(deny, entries...)
+	}
+
+	// An allow-list that ended up empty must not turn into "allow everyone".
+	if len(allowFiles) > 0 && len(allow) == 0 {
+		return nil, fmt.Errorf("--allow-file has no entries, refusing to accept every peer")
+	}
+
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	return model.NewAccessList(allow, deny, ipMode)
+}
+
+// readListFile returns the non-empty lines of path, skipping # comments.
+func readListFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read list file: %w", err)
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, nil
+}
+
+// readHostsFiles collects -z targets from --hosts-file lists.
+func readHostsFiles(paths []string) ([]string, error) {
+	var hosts []string
+	for _, path := range paths {
+		entries, err := readListFile(path)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, entries...)
+	}
+
+	return hosts, nil
+}
+
+// parseListenAddr returns the optional local host and the port for listen mode.
+// Accepted forms are "port", "host port", and "host" together with -p.
+func parseListenAddr(args []string, flagPort int) (string, int, error) {
 	if flagPort > 0 {
-		return flagPort, nil
+		switch len(args) {
+		case 0:
+			return "", flagPort, nil
+		case 1:
+			return strings.TrimSpace(args[0]), flagPort, nil
+		default:
+			return "", 0, fmt.Errorf("too many positional arguments for listen mode")
+		}
 	}
 
 	if len(args) == 0 {
-		return 0, fmt.Errorf("missing port number for listen mode")
+		return "", 0, fmt.Errorf("missing port number for listen mode")
 	}
 
-	if len(args) > 1 {
-		return 0, fmt.Errorf("too many positional arguments for listen mode")
+	if len(args) > 2 {
+		return "", 0, fmt.Errorf("too many positional arguments for listen mode")
+	}
+
+	host := ""
+	if len(args) == 2 {
+		host = strings.TrimSpace(args[0])
 	}
 
-	portCandidate, err := strconv.Atoi(args[0])
+	portCandidate, err := strconv.Atoi(args[len(args)-1])
 	if err != nil {
-		return 0, fmt.Errorf("invalid port syntax")
+		return "", 0, fmt.Errorf("invalid port syntax")
 	}
 
 	if portCandidate <= 0 || portCandidate > 65535 {
-		return 0, fmt.Errorf("invalid port range")
+		return "", 0, fmt.Errorf("invalid port range")
 	}
 
-	return portCandidate, nil
+	return host, portCandidate, nil
 }
 
-func parseScanPort(args []string, flagRange string) (string, []int, error) {
+// parseScanPort splits the -z arguments into host targets and ports. The
+// leading arguments that are not numbers are targets, the rest are ports.
+func parseScanPort(args []string, flagRange string) ([]string, []int, error) {
 	var portRange []int
 	seen := make(map[int]struct{})
 
-	if len(args) == 0 {
-		return "", nil, errors.New("-z missing host, use -h for help")
+	var hosts []string
+	for len(args) > 0 {
+		if _, err := strconv.Atoi(strings.TrimSpace(args[0])); err == nil {
+			break
+		}
+		if host := strings.TrimSpace(args[0]); host != "" {
+			hosts = append(hosts, host)
+		}
+		args = args[1:]
 	}
 
-	host := strings.TrimSpace(args[0])
-	if host == "" {
-		return "", nil, errors.New("-z missing host, use -h for help")
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("-z missing host, use -h for help")
 	}
 
 	addPort := func(portVal int) {
@@ -188,36 +845,36 @@ func parseScanPort(args []string, flagRange string) (string, []int, error) {
 		switch len(parts) {
 		case 1:
 			if err := addPortStr(parts[0]); err != nil {
-				return "", nil, err
+				return nil, nil, err
 			}
 		case 2:
 			startStr, err1 := util.PortCheck(strings.TrimSpace(parts[0]))
 			endStr, err2 := util.PortCheck(strings.TrimSpace(parts[1]))
 			if err1 != nil || err2 != nil {
-				return "", nil, errors.New("port parsing failed, use -h for help")
+				return nil, nil, errors.New("port parsing failed, use -h for help")
 			}
 			start, _ := strconv.Atoi(startStr)
 			end, _ := strconv.Atoi(endStr)
 			if start > end {
-				return "", nil, errors.New("port parsing failed, use -h for help")
+				return nil, nil, errors.New("port parsing failed, use -h for help")
 			}
 			for p := start; p <= end; p++ {
 				addPort(p)
 			}
 		default:
-			return "", nil, errors.New("port parsing failed, use -h for help")
+			return nil, nil, errors.New("port parsing failed, use -h for help")
 		}
 	}
 
-	if len(args) == 1 && len(portRange) == 0 {
-		return "", nil, errors.New("-z missing ports, use -h for help")
+	if len(args) == 0 && len(portRange) == 0 {
+		return nil, nil, errors.New("-z missing ports, use -h for help")
 	}
 
-	for _, strPort := range args[1:] {
+	for _, strPort := range args {
 		if err := addPortStr(strPort); err != nil {
-			return "", nil, err
+			return nil, nil, err
 		}
 	}
 
-	return host, portRange, nil
+	return hosts, portRange, nil
 }
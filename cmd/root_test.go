@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"errors"
+	"io"
+	"nc/model"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -22,7 +27,7 @@ func TestParseScanPort(t *testing.T) {
 		name      string
 		args      []string
 		flagRange string
-		wantHost  string
+		wantHosts []string
 		want      []int
 		wantErr   bool
 		errSubstr string
@@ -31,37 +36,55 @@ func TestParseScanPort(t *testing.T) {
 			name:      "flagRange single port",
 			args:      []string{"example.com"},
 			flagRange: "80",
-			wantHost:  "example.com",
+			wantHosts: []string{"example.com"},
 			want:      []int{80},
 		},
 		{
 			name:      "flagRange two ports (split by :)",
 			args:      []string{"example.com"},
 			flagRange: "80:443",
-			wantHost:  "example.com",
+			wantHosts: []string{"example.com"},
 			want:      makeRange(80, 443),
 		},
 		{
 			name:      "args only multiple ports",
 			args:      []string{"example.com", "22", "80", "443"},
 			flagRange: "",
-			wantHost:  "example.com",
+			wantHosts: []string{"example.com"},
 			want:      []int{22, 80, 443},
 		},
 		{
 			name:      "deduplicate ports (flagRange and args overlap)",
 			args:      []string{"example.com", "80", "22", "80"},
 			flagRange: "80:443",
-			wantHost:  "example.com",
+			wantHosts: []string{"example.com"},
 			want:      append(makeRange(80, 443), 22), // preserves first-seen order
 		},
 		{
 			name:      "whitespace trimming",
 			args:      []string{" example.com ", "  22  ", " 80"},
 			flagRange: " 443 :  8080 ",
-			wantHost:  "example.com",
+			wantHosts: []string{"example.com"},
 			want:      append(makeRange(443, 8080), []int{22, 80}...),
 		},
+		{
+			name:      "several hosts and ranges",
+			args:      []string{"example.com", "10.0.0.0/30", "10.0.1.1-5", "22", "80"},
+			wantHosts: []string{"example.com", "10.0.0.0/30", "10.0.1.1-5"},
+			want:      []int{22, 80},
+		},
+		{
+			name:      "ports only -> missing host",
+			args:      []string{"22", "80"},
+			wantErr:   true,
+			errSubstr: "-z missing host",
+		},
+		{
+			name:      "host after ports -> error",
+			args:      []string{"example.com", "22", "other.example"},
+			wantErr:   true,
+			errSubstr: "port parsing failed",
+		},
 		{
 			name:      "missing host -> error",
 			args:      nil,
@@ -94,11 +117,11 @@ func TestParseScanPort(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			host, got, err := parseScanPort(tt.args, tt.flagRange)
+			hosts, got, err := parseScanPort(tt.args, tt.flagRange)
 
 			if tt.wantErr {
 				if err == nil {
-					t.Fatalf("expected error, got nil; host=%q ports=%v", host, got)
+					t.Fatalf("expected error, got nil; hosts=%q ports=%v", hosts, got)
 				}
 				if tt.errSubstr != "" && !strings.Contains(err.Error(), tt.errSubstr) {
 					t.Fatalf("error=%q, expected to contain %q", err.Error(), tt.errSubstr)
@@ -109,8 +132,8 @@ func TestParseScanPort(t *testing.T) {
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if host != tt.wantHost {
-				t.Fatalf("host=%q, want %q", host, tt.wantHost)
+			if !reflect.DeepEqual(hosts, tt.wantHosts) {
+				t.Fatalf("hosts=%q, want %q", hosts, tt.wantHosts)
 			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Fatalf("got %v, want %v", got, tt.want)
@@ -118,3 +141,325 @@ func TestParseScanPort(t *testing.T) {
 		})
 	}
 }
+
+func TestParseProxy(t *testing.T) {
+	tests := []struct {
+		name      string
+		addr      string
+		kind      string
+		auth      string
+		want      *model.Proxy
+		errSubstr string
+	}{
+		{
+			name: "no proxy",
+		},
+		{
+			name: "socks5 with credentials",
+			addr: "bastion:1080",
+			kind: "SOCKS5",
+			auth: "user:p:ss",
+			want: &model.Proxy{Address: "bastion:1080", Type: model.ProxySOCKS5, Username: "user", Password: "p:ss"},
+		},
+		{
+			name: "ipv6 http proxy",
+			addr: "[::1]:3128",
+			kind: "http",
+			want: &model.Proxy{Address: "[::1]:3128", Type: model.ProxyHTTP},
+		},
+		{
+			name:      "missing port",
+			addr:      "bastion",
+			kind:      "http",
+			errSubstr: "invalid proxy address",
+		},
+		{
+			name:      "bad port",
+			addr:      "bastion:0",
+			kind:      "http",
+			errSubstr: "invalid proxy port",
+		},
+		{
+			name:      "unknown type",
+			addr:      "bastion:1080",
+			kind:      "socks6",
+			errSubstr: "unknown proxy type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProxy(tt.addr, tt.kind, tt.auth)
+
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("error=%v, expected to contain %q", err, tt.errSubstr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnixSocket(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		datagram  bool
+		packet    bool
+		mode      string
+		want      *model.UnixSocket
+		errSubstr string
+	}{
+		{
+			name: "stream socket",
+			args: []string{"/var/run/docker.sock"},
+			want: &model.UnixSocket{Path: "/var/run/docker.sock", Type: "unix"},
+		},
+		{
+			name:     "abstract datagram socket",
+			args:     []string{"@supervisor"},
+			datagram: true,
+			want:     &model.UnixSocket{Path: "@supervisor", Type: "unixgram"},
+		},
+		{
+			name:   "seqpacket with mode",
+			args:   []string{"/tmp/nc.sock"},
+			packet: true,
+			mode:   "0660",
+			want:   &model.UnixSocket{Path: "/tmp/nc.sock", Type: "unixpacket", Mode: 0o660},
+		},
+		{
+			name:      "missing path",
+			errSubstr: "-U missing socket path",
+		},
+		{
+			name:      "invalid mode",
+			args:      []string{"/tmp/nc.sock"},
+			mode:      "0999",
+			errSubstr: "invalid socket mode",
+		},
+		{
+			name:      "datagram and seqpacket",
+			args:      []string{"/tmp/nc.sock"},
+			datagram:  true,
+			packet:    true,
+			errSubstr: "cannot combine",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUnixSocket(tt.args, tt.datagram, tt.packet, tt.mode)
+
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("error=%v, expected to contain %q", err, tt.errSubstr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseListenAddr(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		flagPort  int
+		wantHost  string
+		wantPort  int
+		errSubstr string
+	}{
+		{name: "port only", args: []string{"8080"}, wantPort: 8080},
+		{name: "host and port", args: []string{"127.0.0.1", "8080"}, wantHost: "127.0.0.1", wantPort: 8080},
+		{name: "link-local with zone", args: []string{"fe80::1%eth0", "9000"}, wantHost: "fe80::1%eth0", wantPort: 9000},
+		{name: "flag port", flagPort: 8080, wantPort: 8080},
+		{name: "flag port with host", args: []string{"::1"}, flagPort: 8080, wantHost: "::1", wantPort: 8080},
+		{name: "missing port", errSubstr: "missing port number"},
+		{name: "too many args", args: []string{"a", "b", "c"}, errSubstr: "too many positional arguments"},
+		{name: "bad port", args: []string{"localhost", "http"}, errSubstr: "invalid port syntax"},
+		{name: "port out of range", args: []string{"70000"}, errSubstr: "invalid port range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, err := parseListenAddr(tt.args, tt.flagPort)
+
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("error=%v, expected to contain %q", err, tt.errSubstr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Fatalf("got %q %d, want %q %d", host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		spec      string
+		wantUp    int64
+		wantDown  int64
+		errSubstr string
+	}{
+		{spec: ""},
+		{spec: "1000", wantUp: 1000, wantDown: 1000},
+		{spec: "64K", wantUp: 64 << 10, wantDown: 64 << 10},
+		{spec: "1M:256k", wantUp: 1 << 20, wantDown: 256 << 10},
+		{spec: "1.5KB/s", wantUp: 1536, wantDown: 1536},
+		{spec: ":2G", wantDown: 2 << 30},
+		{spec: "512:", wantUp: 512},
+		{spec: "fast", errSubstr: "invalid rate"},
+		{spec: "-5", errSubstr: "invalid rate"},
+		{spec: "Inf", errSubstr: "invalid rate"},
+		{spec: "NaN:1K", errSubstr: "invalid rate"},
+		{spec: "1e30", errSubstr: "too large"},
+		{spec: "9000000000G", errSubstr: "too large"},
+		{spec: "0.5", errSubstr: "at least 1 byte"},
+		{spec: "0", errSubstr: "at least 1 byte"},
+		{spec: "1K:0.0001K", errSubstr: "at least 1 byte"},
+		{spec: "1.5", wantUp: 1, wantDown: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			up, down, err := parseRateLimit(tt.spec)
+
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("error=%v, expected to contain %q", err, tt.errSubstr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if up != tt.wantUp || down != tt.wantDown {
+				t.Fatalf("got %d:%d, want %d:%d", up, down, tt.wantUp, tt.wantDown)
+			}
+		})
+	}
+}
+
+func TestBuildAccessListFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	empty := write("empty", "")
+	comments := write("comments", "# nobody yet\n\n   # still nobody\n")
+	lan := write("lan", "10.0.0.0/8 # office\n")
+
+	tests := []struct {
+		name       string
+		allow      []string
+		allowFiles []string
+		wantNil    bool
+		errSubstr  string
+	}{
+		{name: "no lists", wantNil: true},
+		{name: "empty file", allowFiles: []string{empty}, errSubstr: "no entries"},
+		{name: "only comments", allowFiles: []string{comments}, errSubstr: "no entries"},
+		{name: "empty file plus flag", allow: []string{"127.0.0.1"}, allowFiles: []string{empty}},
+		{name: "entries", allowFiles: []string{comments, lan}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowList, allowFiles, denyList, denyFiles = tt.allow, tt.allowFiles, nil, nil
+			t.Cleanup(func() { allowList, allowFiles = nil, nil })
+
+			acl, err := buildAccessList(model.IPAny)
+
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("error=%v, expected to contain %q", err, tt.errSubstr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (acl == nil) != tt.wantNil {
+				t.Fatalf("acl=%v, want nil=%v", acl, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestHexDumpFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.txt")
+	hexDump = path
+	t.Cleanup(func() { hexDump, stdinPolicy = "", "" })
+
+	// Validation happens before -x is opened, so a bad flag leaves no file.
+	stdinPolicy = "bogus"
+	if _, err := buildOptions(); err == nil {
+		t.Fatal("bad --stdin-policy should be rejected")
+	}
+	stdinPolicy = ""
+	opts, err := buildOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("-x file exists before the session: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		dump     string
+		runErr   error
+		wantFile bool
+	}{
+		{name: "failed before any traffic", runErr: errors.New("connection refused")},
+		{name: "failed after traffic", dump: "00000000  68 69", runErr: errors.New("reset"), wantFile: true},
+		{name: "empty session", wantFile: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := opts
+			if err := openHexDump(&session); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(session.HexDump, tt.dump); err != nil {
+				t.Fatal(err)
+			}
+			closeHexDump(session, tt.runErr)
+
+			if _, err := os.Stat(path); (err == nil) != tt.wantFile {
+				t.Errorf("file exists=%v, want %v", err == nil, tt.wantFile)
+			}
+			_ = os.Remove(path)
+		})
+	}
+}
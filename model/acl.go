@@ -0,0 +1,111 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// accessRule matches peers inside one network. source keeps the entry as the
+// user wrote it, so rejections can name the rule responsible.
+type accessRule struct {
+	source  string
+	network *net.IPNet
+}
+
+// AccessList decides which peers a listener admits. Deny rules win over allow
+// rules; a non-empty allow list rejects every peer it does not match.
+type AccessList struct {
+	allow []accessRule
+	deny  []accessRule
+}
+
+// NewAccessList parses allow and deny entries. Each entry is a CIDR block, an
+// IP address, or a hostname that is resolved once, up front.
+func NewAccessList(allow, deny []string, ipMode IPMode) (*AccessList, error) {
+	acl := &AccessList{}
+
+	for _, entry := range allow {
+		rules, err := parseAccessEntry(entry, ipMode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --allow entry: %w", err)
+		}
+		acl.allow = append(acl.allow, rules...)
+	}
+
+	for _, entry := range deny {
+		rules, err := parseAccessEntry(entry, ipMode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --deny entry: %w", err)
+		}
+		acl.deny = append(acl.deny, rules...)
+	}
+
+	return acl, nil
+}
+
+func parseAccessEntry(entry string, ipMode IPMode) ([]accessRule, error) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return nil, fmt.Errorf("empty entry")
+	}
+
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		return []accessRule{{source: entry, network: network}}, nil
+	}
+
+	if ip := net.ParseIP(entry); ip != nil {
+		return []accessRule{{source: entry, network: hostNetwork(ip)}}, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(context.Background(), ipMode.ResolveNetwork(), entry)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]accessRule, 0, len(addrs))
+	for _, addr := range addrs {
+		ip := net.IP(addr.Unmap().AsSlice())
+		rules = append(rules, accessRule{source: entry + " (" + ip.String() + ")", network: hostNetwork(ip)})
+	}
+
+	return rules, nil
+}
+
+// hostNetwork returns the single-address network containing ip.
+func hostNetwork(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// Check reports whether ip may connect. When it may not, reason names the
+// rule that rejected it.
+func (a *AccessList) Check(ip net.IP) (ok bool, reason string) {
+	for _, rule := range a.deny {
+		if rule.network.Contains(ip) {
+			return false, "deny " + rule.source
+		}
+	}
+
+	if len(a.allow) == 0 {
+		return true, ""
+	}
+
+	for _, rule := range a.allow {
+		if rule.network.Contains(ip) {
+			return true, ""
+		}
+	}
+
+	return false, "not in allow list"
+}
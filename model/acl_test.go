@@ -0,0 +1,41 @@
+package model
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAccessListCheck(t *testing.T) {
+	acl, err := NewAccessList(
+		[]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"},
+		[]string{"10.0.5.0/24"},
+		IPAny,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip         string
+		wantOK     bool
+		wantReason string
+	}{
+		{"10.1.2.3", true, ""},
+		{"::ffff:10.1.2.3", true, ""},
+		{"10.0.5.9", false, "deny 10.0.5.0/24"},
+		{"192.168.1.5", true, ""},
+		{"192.168.1.6", false, "not in allow list"},
+		{"2001:db8::1", true, ""},
+	}
+
+	for _, tt := range tests {
+		ok, reason := acl.Check(net.ParseIP(tt.ip))
+		if ok != tt.wantOK || reason != tt.wantReason {
+			t.Errorf("Check(%s)=%v %q, want %v %q", tt.ip, ok, reason, tt.wantOK, tt.wantReason)
+		}
+	}
+
+	if _, err := NewAccessList([]string{"10.0.0.0/33"}, nil, IPAny); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
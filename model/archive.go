@@ -0,0 +1,355 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+)
+
+// Compression selects how --send-dir compresses the tar stream.
+type Compression int
+
+const (
+	// CompressNone sends a plain tar stream.
+	CompressNone Compression = iota
+	// CompressGzip compresses the stream with gzip.
+	CompressGzip
+	// CompressZstd compresses the stream with the zstd command, which must be on PATH at both ends.
+	CompressZstd
+)
+
+// String returns the name used for the compression on the command line.
+func (c Compression) String() string {
+	switch c {
+	case CompressGzip:
+		return "gzip"
+	case CompressZstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// sendDir streams the contents of dir to conn as a tar archive and closes the
+// sending side so the receiver sees the end of the stream.
+func sendDir(conn net.Conn, dir string, compression Compression) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	cw, err := compressWriter(conn, compression)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+	entries, total := 0, int64(0)
+
+	walkErr := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		switch {
+		case info.Mode().IsRegular(), info.IsDir():
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(name); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "skipping %s: unsupported file type\n", name)
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		entries++
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		n, err := io.Copy(tw, f)
+		total += n
+		return err
+	})
+
+	if walkErr != nil {
+		_ = cw.Close()
+		return walkErr
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	if err := closeWrite(conn); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "sent %d entries (%s) from %s\n", entries, formatBytes(total), dir)
+	return nil
+}
+
+// recvDir extracts the tar archive arriving on conn into dir. Every entry is
+// created through an os.Root, so neither ../ names nor symlinks in the
+// archive can place files outside dir.
+func recvDir(conn net.Conn, dir string) error {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	r, err := decompressReader(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	var dirs []*tar.Header
+	entries, total := 0, int64(0)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("refusing unsafe path %q in archive", hdr.Name)
+		}
+		name = filepath.FromSlash(name)
+		mode := fs.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(name, 0o700); err != nil {
+				return err
+			}
+			// Permissions are applied last so read-only directories can still be filled.
+			dirs = append(dirs, hdr)
+		case tar.TypeReg:
+			if err := prepareEntry(root, name); err != nil {
+				return err
+			}
+			f, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(f, tr)
+			total += n
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			if err := root.Chmod(name, mode); err != nil {
+				return err
+			}
+			_ = root.Chtimes(name, hdr.ModTime, hdr.ModTime)
+		case tar.TypeSymlink:
+			if err := prepareEntry(root, name); err != nil {
+				return err
+			}
+			if err := root.Symlink(hdr.Linkname, name); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			target := filepath.FromSlash(path.Clean(hdr.Linkname))
+			if !filepath.IsLocal(target) {
+				return fmt.Errorf("refusing unsafe hard link %q in archive", hdr.Linkname)
+			}
+			if err := prepareEntry(root, name); err != nil {
+				return err
+			}
+			if err := root.Link(target, name); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "skipping %s: unsupported entry type %q\n", hdr.Name, hdr.Typeflag)
+			continue
+		}
+		entries++
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name := filepath.FromSlash(path.Clean(dirs[i].Name))
+		if err := root.Chmod(name, fs.FileMode(dirs[i].Mode).Perm()); err != nil {
+			return err
+		}
+		_ = root.Chtimes(name, dirs[i].ModTime, dirs[i].ModTime)
+	}
+
+	fmt.Fprintf(os.Stderr, "received %d entries (%s) into %s\n", entries, formatBytes(total), dir)
+	return nil
+}
+
+// prepareEntry creates the parent directories of name and removes whatever
+// non-directory is already there, so an old symlink is replaced rather than followed.
+func prepareEntry(root *os.Root, name string) error {
+	if parent := filepath.Dir(name); parent != "." {
+		if err := root.MkdirAll(parent, 0o755); err != nil {
+			return err
+		}
+	}
+
+	info, err := root.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s already exists as a directory", name)
+	}
+
+	return root.Remove(name)
+}
+
+// compressWriter wraps w in the selected compressor. Closing it flushes the
+// compressor but leaves w open.
+func compressWriter(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		cmd := exec.Command("zstd", "-q", "-c")
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		return startFilter(cmd)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// decompressReader recognises a gzip or zstd stream by its magic bytes and
+// falls back to reading an uncompressed archive.
+func decompressReader(r *bufio.Reader) (io.ReadCloser, error) {
+	head, err := r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		// Stop at the end of the first member instead of waiting for another one.
+		zr.Multistream(false)
+		return zr, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		cmd := exec.Command("zstd", "-d", "-q", "-c")
+		cmd.Stdin = r
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("cannot start zstd: %w", err)
+		}
+		return &filterReader{ReadCloser: stdout, cmd: cmd}, nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// filterWriter feeds an external compressor; Close waits for it to finish writing.
+type filterWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func startFilter(cmd *exec.Cmd) (io.WriteCloser, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start %s: %w", cmd.Path, err)
+	}
+
+	return &filterWriter{WriteCloser: stdin, cmd: cmd}, nil
+}
+
+func (f *filterWriter) Close() error {
+	if err := f.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return f.cmd.Wait()
+}
+
+// filterReader reads from an external decompressor; Close reaps the process.
+type filterReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (f *filterReader) Close() error {
+	_ = f.ReadCloser.Close()
+	return f.cmd.Wait()
+}
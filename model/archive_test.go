@@ -0,0 +1,67 @@
+package model
+
+import (
+	"archive/tar"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecvDirRejectsEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tar.Header
+		wantErr string
+	}{
+		{
+			name:    "dot dot",
+			entries: []tar.Header{{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0o644}},
+			wantErr: "unsafe path",
+		},
+		{
+			name:    "absolute",
+			entries: []tar.Header{{Name: "/tmp/escape", Typeflag: tar.TypeReg, Mode: 0o644}},
+			wantErr: "unsafe path",
+		},
+		{
+			name: "through symlink",
+			entries: []tar.Header{
+				{Name: "out", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0o777},
+				{Name: "out/escape", Typeflag: tar.TypeReg, Mode: 0o644},
+			},
+			wantErr: "escape",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "dst")
+			if err := os.Mkdir(dst, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			sender, receiver := net.Pipe()
+			go func() {
+				tw := tar.NewWriter(sender)
+				for _, hdr := range tt.entries {
+					if err := tw.WriteHeader(&hdr); err != nil {
+						break
+					}
+				}
+				_ = tw.Close()
+				_ = sender.Close()
+			}()
+
+			err := Options{ExtractDir: dst}.runTransfer(receiver)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("runTransfer error = %v, want it to mention %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "escape")); !os.IsNotExist(err) {
+				t.Error("archive wrote outside the target directory")
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// bannerTimeout is how long an open port gets to say something first.
+	bannerTimeout = 2 * time.Second
+	// bannerLinger collects the rest of a multi-line banner once it has started.
+	bannerLinger = 200 * time.Millisecond
+	// bannerReadMax caps how much of a service's greeting is read.
+	bannerReadMax = 1024
+	// bannerMax caps the sanitized banner shown in results.
+	bannerMax = 160
+)
+
+// grabBanner sends the optional probe and reads what the service answers
+// within bannerTimeout, bounded by the scan deadline.
+func grabBanner(ctx context.Context, conn net.Conn, probe []byte) ([]byte, error) {
+	deadline := time.Now().Add(bannerTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if len(probe) > 0 {
+		if _, err := conn.Write(probe); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, bannerReadMax)
+	n := 0
+	for n < len(buf) {
+		m, err := conn.Read(buf[n:])
+		n += m
+		if err != nil {
+			var netErr net.Error
+			if n > 0 || errors.As(err, &netErr) && netErr.Timeout() {
+				// Silence, a closed connection or the end of the greeting.
+				break
+			}
+			return nil, err
+		}
+		if m > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(bannerLinger))
+		}
+	}
+
+	return buf[:n], nil
+}
+
+// sanitizeBanner renders raw service output as one printable line: control
+// and non-ASCII bytes are escaped and long banners are cut at bannerMax.
+func sanitizeBanner(raw []byte) string {
+	raw = []byte(strings.TrimRight(string(raw), "\r\n\t \x00"))
+
+	var b strings.Builder
+	for _, c := range raw {
+		var piece string
+		switch {
+		case c == '\r':
+			piece = `\r`
+		case c == '\n':
+			piece = `\n`
+		case c == '\t':
+			piece = `\t`
+		case c == '\\':
+			piece = `\\`
+		case c < 0x20 || c > 0x7e:
+			piece = fmt.Sprintf(`\x%02x`, c)
+		default:
+			piece = string(c)
+		}
+
+		if b.Len()+len(piece) > bannerMax {
+			b.WriteString("...")
+			break
+		}
+		b.WriteString(piece)
+	}
+
+	return b.String()
+}
+
+// decodeEscapes turns \r, \n, \t, \0, \\ and \xNN in s into the bytes they
+// stand for, so probes can be typed on the command line.
+func decodeEscapes(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out = append(out, s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return nil, fmt.Errorf("trailing backslash in %q", s)
+		}
+		switch s[i] {
+		case 'r':
+			out = append(out, '\r')
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		case '0':
+			out = append(out, 0)
+		case '\\':
+			out = append(out, '\\')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("short \\x escape in %q", s)
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid \\x escape in %q", s)
+			}
+			out = append(out, byte(v))
+			i += 2
+		default:
+			return nil, fmt.Errorf("unknown escape \\%c in %q", s[i], s)
+		}
+	}
+
+	return out, nil
+}
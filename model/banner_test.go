@@ -0,0 +1,123 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitizeBanner(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"SSH-2.0-OpenSSH_9.6\r\n", "SSH-2.0-OpenSSH_9.6"},
+		{"220-mail ESMTP\r\n220 ready\r\n", `220-mail ESMTP\r\n220 ready`},
+		{"\x00\x01bin\xff", `\x00\x01bin\xff`},
+		{`C:\path`, `C:\\path`},
+		{strings.Repeat("a", 200), strings.Repeat("a", bannerMax) + "..."},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeBanner([]byte(tt.raw)); got != tt.want {
+			t.Errorf("sanitizeBanner(%q)=%q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeEscapes(t *testing.T) {
+	got, err := decodeEscapes(`HEAD / HTTP/1.0\r\n\r\n\x00\\`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte("HEAD / HTTP/1.0\r\n\r\n\x00\\"); !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{`\`, `\x4`, `\xzz`, `\q`} {
+		if _, err := decodeEscapes(bad); err == nil {
+			t.Errorf("decodeEscapes(%q) should fail", bad)
+		}
+	}
+}
+
+// bannerServer accepts connections on a loopback port and hands each to serve.
+func bannerServer(t *testing.T, serve func(net.Conn)) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestScanPortBanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		serve func(net.Conn)
+		probe string
+		want  string
+	}{
+		{
+			name: "greeting",
+			serve: func(c net.Conn) {
+				_, _ = io.WriteString(c, "220-mail ESMTP\r\n")
+				time.Sleep(50 * time.Millisecond)
+				_, _ = io.WriteString(c, "220 ready\r\n")
+				_, _ = io.Copy(io.Discard, c)
+			},
+			want: `220-mail ESMTP\r\n220 ready`,
+		},
+		{
+			// Says nothing until the client gives up; the port is still open.
+			name:  "silent",
+			serve: func(c net.Conn) { _, _ = io.Copy(io.Discard, c) },
+			want:  "",
+		},
+		{
+			name:  "probe echo",
+			serve: func(c net.Conn) { _, _ = io.Copy(c, c) },
+			probe: "PING\r\n",
+			want:  "PING",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := bannerServer(t, tt.serve)
+
+			// The scan deadline cuts the silent case short of bannerTimeout.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			opts := ScanOptions{Banner: true, probe: []byte(tt.probe)}
+			res := scanPort(ctx, &net.Dialer{}, "127.0.0.1", port, false, 0, IPv4Only, opts)
+			if res.State != stateOpen {
+				t.Fatalf("state = %v (%v), want %v", res.State, res.Err, stateOpen)
+			}
+			if res.Banner != tt.want {
+				t.Errorf("banner = %q, want %q", res.Banner, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package model
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// bindToDevice returns a socket control hook that pins the socket to the
+// named network interface with SO_BINDTODEVICE.
+func bindToDevice(iface string) (func(network, address string, c syscall.RawConn) error, error) {
+	if _, err := net.InterfaceByName(iface); err != nil {
+		return nil, fmt.Errorf("invalid interface %q: %w", iface, err)
+	}
+
+	return func(_, _ string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.BindToDevice(int(fd), iface)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("SO_BINDTODEVICE %s: %w", iface, sockErr)
+		}
+		return nil
+	}, nil
+}
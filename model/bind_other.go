@@ -0,0 +1,13 @@
+//go:build !linux
+
+package model
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToDevice is only available on Linux, where SO_BINDTODEVICE exists.
+func bindToDevice(iface string) (func(network, address string, c syscall.RawConn) error, error) {
+	return nil, fmt.Errorf("binding to interface %q is only supported on Linux", iface)
+}
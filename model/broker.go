@@ -0,0 +1,188 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// brokerBacklog is how many messages may wait for one client before it is
+// considered too slow and dropped.
+const brokerBacklog = 256
+
+// chatLineMax caps a chat line; anything longer is cut off at this length,
+// so a client cannot make the server buffer an endless line.
+const chatLineMax = 4096
+
+// broker relays everything one client sends to every other connected client.
+// In chat mode data is relayed line by line, prefixed with the sender's address.
+// Every client has its own outbound queue, so one that stops reading cannot
+// hold up the others.
+type broker struct {
+	mu      sync.Mutex
+	clients map[net.Conn]*brokerClient
+	nextID  int
+	chat    bool
+	verbose bool
+}
+
+type brokerClient struct {
+	name string
+	out  chan []byte
+}
+
+func newBroker(chat, verbose bool) *broker {
+	return &broker{clients: make(map[net.Conn]*brokerClient), chat: chat, verbose: verbose}
+}
+
+// serve registers conn and relays its data until it disconnects.
+func (b *broker) serve(conn net.Conn) error {
+	defer conn.Close()
+
+	name := b.join(conn)
+	defer b.leave(conn, name)
+
+	if !b.chat {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				b.broadcast(conn, append([]byte(nil), buf[:n]...))
+			}
+			if err != nil {
+				return readErr(err)
+			}
+		}
+	}
+
+	r := bufio.NewReaderSize(conn, chatLineMax)
+	// truncated is set while the rest of an overlong line is skipped.
+	truncated := false
+	for {
+		line, err := r.ReadSlice('\n')
+		if len(line) > 0 && !truncated {
+			msg := append([]byte("<"+name+"> "), line...)
+			if msg[len(msg)-1] != '\n' {
+				msg = append(msg, '\n')
+			}
+			b.broadcast(conn, msg)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			truncated = true
+			continue
+		}
+		truncated = false
+		if err != nil {
+			return readErr(err)
+		}
+	}
+}
+
+func (b *broker) join(conn net.Conn) string {
+	b.mu.Lock()
+	b.nextID++
+	name := conn.RemoteAddr().String()
+	if name == "" || name == "@" {
+		name = "user" + strconv.Itoa(b.nextID)
+	}
+	client := &brokerClient{name: name, out: make(chan []byte, brokerBacklog)}
+	b.clients[conn] = client
+	count := len(b.clients)
+	b.mu.Unlock()
+
+	go b.send(conn, client)
+
+	if b.verbose {
+		fmt.Fprintf(os.Stderr, "broker: %s joined, %d connected\n", name, count)
+	}
+	if b.chat {
+		b.broadcast(conn, []byte("<announce> "+name+" is connected\n"))
+	}
+
+	return name
+}
+
+func (b *broker) leave(conn net.Conn, name string) {
+	b.mu.Lock()
+	if client, ok := b.clients[conn]; ok {
+		delete(b.clients, conn)
+		close(client.out)
+	}
+	count := len(b.clients)
+	b.mu.Unlock()
+
+	if b.verbose {
+		fmt.Fprintf(os.Stderr, "broker: %s left, %d connected\n", name, count)
+	}
+	if b.chat {
+		b.broadcast(conn, []byte("<announce> "+name+" has disconnected\n"))
+	}
+}
+
+// send writes the queued messages of one client until it leaves.
+func (b *broker) send(conn net.Conn, client *brokerClient) {
+	failed := false
+	for p := range client.out {
+		if failed {
+			continue
+		}
+		if _, err := conn.Write(p); err != nil {
+			if b.verbose {
+				fmt.Fprintf(os.Stderr, "broker: write to %s failed: %v\n", client.name, err)
+			}
+			// The client is dropped once its own read fails.
+			failed = true
+			dropConn(conn)
+		}
+	}
+}
+
+// broadcast queues p for every client except from. A client whose queue is
+// full is disconnected rather than allowed to stall the relay.
+func (b *broker) broadcast(from net.Conn, p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c, client := range b.clients {
+		if c == from {
+			continue
+		}
+		select {
+		case client.out <- p:
+		default:
+			if b.verbose {
+				fmt.Fprintf(os.Stderr, "broker: dropping %s, it is not reading\n", client.name)
+			}
+			dropConn(c)
+		}
+	}
+}
+
+// dropConn closes the transport under conn. Closing the outermost layer could
+// block, for example on a TLS close_notify behind a write stuck on the peer.
+func dropConn(conn net.Conn) {
+	for {
+		inner, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = inner.NetConn()
+	}
+	_ = conn.Close()
+}
+
+// readErr hides the EOF that ends every normal session.
+func readErr(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// joinBroker connects n clients to b over net.Pipe, one after the other.
+func joinBroker(t *testing.T, b *broker, n int) []net.Conn {
+	t.Helper()
+
+	clients := make([]net.Conn, n)
+	for i := range clients {
+		client, server := net.Pipe()
+		t.Cleanup(func() { client.Close() })
+		go b.serve(server)
+		clients[i] = client
+		waitForClients(t, b, i+1)
+	}
+
+	return clients
+}
+
+func waitForClients(t *testing.T, b *broker, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		b.mu.Lock()
+		count := len(b.clients)
+		b.mu.Unlock()
+		if count == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients connected, want %d", count, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBrokerRelaysToOtherClients(t *testing.T) {
+	b := newBroker(false, false)
+	c := joinBroker(t, b, 3)
+
+	if _, err := io.WriteString(c[0], "hello\n"); err != nil {
+		t.Fatal(err)
+	}
+	for _, peer := range c[1:] {
+		_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+		line, err := bufio.NewReader(peer).ReadString('\n')
+		if err != nil || line != "hello\n" {
+			t.Errorf("peer got %q, %v", line, err)
+		}
+	}
+
+	// The sender does not get its own data back.
+	_ = c[0].SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, _ := c[0].Read(make([]byte, 16)); n != 0 {
+		t.Error("sender received its own message")
+	}
+}
+
+func TestBrokerDropsSlowClient(t *testing.T) {
+	b := newBroker(false, false)
+	c := joinBroker(t, b, 3)
+	// c[2] never reads; the relay between c[0] and c[1] must keep going.
+
+	// The sender waits for each message to reach c[1], so only c[2] falls behind.
+	const messages = brokerBacklog * 2
+	r := bufio.NewReader(c[1])
+	_ = c[1].SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := range messages {
+		if _, err := io.WriteString(c[0], "tick\n"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.ReadString('\n'); err != nil {
+			t.Fatalf("fast client stopped after %d of %d messages: %v", i, messages, err)
+		}
+	}
+
+	waitForClients(t, b, 2)
+}
+
+func TestBrokerChat(t *testing.T) {
+	b := newBroker(true, false)
+	c := joinBroker(t, b, 2)
+
+	r := bufio.NewReader(c[0])
+	_ = c[0].SetReadDeadline(time.Now().Add(2 * time.Second))
+	// c[0] saw c[1] join.
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, "<announce> ") {
+		t.Fatalf("announcement %q, %v", line, err)
+	}
+
+	if _, err := io.WriteString(c[1], "hi there"); err != nil {
+		t.Fatal(err)
+	}
+	c[1].Close()
+
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "<") || !strings.HasSuffix(line, "> hi there\n") {
+		t.Errorf("chat line %q, %v", line, err)
+	}
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasSuffix(line, " has disconnected\n") {
+		t.Errorf("leave announcement %q, %v", line, err)
+	}
+}
+
+func TestBrokerChatTruncatesLongLines(t *testing.T) {
+	b := newBroker(true, false)
+	c := joinBroker(t, b, 2)
+
+	r := bufio.NewReader(c[0])
+	_ = c[0].SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_, _ = io.WriteString(c[1], strings.Repeat("x", 3*chatLineMax)+"\nnext\n")
+	}()
+
+	// Only the first chatLineMax bytes are relayed; the rest of the line is dropped.
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := strings.Index(line, "> "); i < 0 || line[i+2:] != strings.Repeat("x", chatLineMax)+"\n" {
+		t.Errorf("long line relayed as %d bytes", len(line))
+	}
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasSuffix(line, "> next\n") {
+		t.Errorf("next line %q, %v", line, err)
+	}
+}
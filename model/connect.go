@@ -5,18 +5,21 @@ Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
 package model
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"nc/util"
 	"net"
 	"os"
+	"strings"
 	"time"
 )
 
 // ConnectWithTimer establishes a connection with a timeout (idleSeconds).
 // If idleSeconds > 0, the connection will be terminated after the specified duration.
-func ConnectWithTimer(host string, portStr string, verbose bool, udp bool, idleSeconds int, noDNSCheck bool, ipMode IPMode) error {
+// When opts.Exec is set, a program is started and wired to the connection instead of stdin/stdout.
+func ConnectWithTimer(host string, portStr string, verbose bool, udp bool, idleSeconds int, noDNSCheck bool, ipMode IPMode, opts Options) error {
 	var ctx context.Context
 	var cancel context.CancelFunc
 
@@ -28,39 +31,113 @@ func ConnectWithTimer(host string, portStr string, verbose bool, udp bool, idleS
 		ctx = context.Background()
 	}
 
-	return connect(ctx, host, portStr, verbose, udp, noDNSCheck, ipMode)
+	return connect(ctx, host, portStr, verbose, udp, noDNSCheck, ipMode, opts)
 }
 
 // connect orchestrates the connection process: validation, establishment, and I/O handling.
-func connect(ctx context.Context, host string, portStr string, verbose bool, udp bool, noDNSCheck bool, ipMode IPMode) error {
-	// Validate the port number
-	port, err := util.PortCheck(portStr)
-	if err != nil {
-		return err
+func connect(ctx context.Context, host string, portStr string, verbose bool, udp bool, noDNSCheck bool, ipMode IPMode, opts Options) error {
+	var network, address string
+
+	if opts.Unix != nil {
+		network, address = opts.Unix.Type, opts.Unix.Path
+	} else {
+		// Validate the port number
+		port, err := util.PortCheck(portStr)
+		if err != nil {
+			return err
+		}
+
+		if err := ipMode.ValidateHost(host, noDNSCheck); err != nil {
+			return err
+		}
+
+		network, address = ipMode.Network(udp), net.JoinHostPort(host, port)
 	}
 
-	if err := ipMode.ValidateHost(host, noDNSCheck); err != nil {
-		return err
+	if opts.Proxy != nil && !strings.HasPrefix(network, "tcp") {
+		return fmt.Errorf("proxy can only be used for TCP connections")
+	}
+	datagram := strings.HasPrefix(network, "udp") || network == "unixgram"
+	if opts.TLS != nil && datagram {
+		return fmt.Errorf("TLS cannot be used over datagram sockets")
+	}
+	if opts.transferring() && datagram {
+		return fmt.Errorf("file transfer requires a stream socket")
+	}
+
+	forward := &net.Dialer{}
+	if opts.Unix == nil && (opts.SourceAddr != "" || opts.SourcePort > 0) {
+		laddr, err := sourceAddr(network, opts, ipMode)
+		if err != nil {
+			return err
+		}
+		forward.LocalAddr = laddr
+		forward.Control = reuseAddr
+	}
+
+	dialer := newDialer(forward, opts.Proxy, ipMode)
+	if network == "unixgram" {
+		ud, err := newUnixgramDialer()
+		if err != nil {
+			return err
+		}
+		defer ud.cleanup()
+		dialer = ud
 	}
 
 	// Attempt to establish the connection (with retries)
-	conn, err := establishConnection(ctx, host, port, verbose, udp, ipMode)
+	conn, err := establishConnection(ctx, dialer, network, address, verbose, opts)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
+	if opts.TLS != nil {
+		conn, err = tlsClient(ctx, conn, host, opts.TLS, verbose)
+		if err != nil {
+			return err
+		}
+	}
+
+	conn = opts.wrap(conn)
+	defer conn.Close()
+
+	// Hand the connection to a child process when -e/-c is set
+	if opts.Exec != "" {
+		return runExec(ctx, conn, opts)
+	}
+
+	// Send or receive a file when --send/--recv is set; -w still bounds the session
+	if opts.transferring() {
+		stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+		defer stop()
+		return opts.runTransfer(conn)
+	}
+
 	// Handle data transfer between Stdin/Stdout and the connection
-	return handleIO(ctx, conn)
+	return handleIO(ctx, conn, opts)
 }
 
-// establishConnection attempts to connect to the target host/port.
-// It retries every second until successful or until the context is canceled.
-func establishConnection(ctx context.Context, host, port string, verbose, udp bool, ipMode IPMode) (net.Conn, error) {
-	var d net.Dialer
-	network := ipMode.Network(udp)
-	address := net.JoinHostPort(host, port)
+// sourceAddr builds the local address for -s/-p in connect mode.
+func sourceAddr(network string, opts Options, ipMode IPMode) (net.Addr, error) {
+	if opts.SourcePort < 0 || opts.SourcePort > 65535 {
+		return nil, fmt.Errorf("invalid source port")
+	}
+
+	ip, err := resolveSource(opts.SourceAddr, ipMode)
+	if err != nil {
+		return nil, err
+	}
 
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: ip, Port: opts.SourcePort}, nil
+	}
+	return &net.TCPAddr{IP: ip, Port: opts.SourcePort}, nil
+}
+
+// establishConnection attempts to connect to the target address.
+// It retries every second until successful or until the context is canceled.
+func establishConnection(ctx context.Context, d contextDialer, network, address string, verbose bool, opts Options) (net.Conn, error) {
 	for {
 		// Check if context is canceled before trying
 		if ctx.Err() != nil {
@@ -70,13 +147,17 @@ func establishConnection(ctx context.Context, host, port string, verbose, udp bo
 		conn, err := d.DialContext(ctx, network, address)
 		if err == nil {
 			if verbose {
-				fmt.Println("Connected to", address)
+				if opts.Proxy != nil {
+					fmt.Fprintln(os.Stderr, "Connected to", address, "via", opts.Proxy.Type, "proxy", opts.Proxy.Address)
+				} else {
+					fmt.Fprintln(os.Stderr, "Connected to", address)
+				}
 			}
 			return conn, nil
 		}
 
 		if verbose {
-			fmt.Println("Connection failed, retrying...")
+			fmt.Fprintln(os.Stderr, "Connection failed, retrying...")
 		}
 
 		// Wait for 1 second or context cancellation before retrying
@@ -89,33 +170,76 @@ func establishConnection(ctx context.Context, host, port string, verbose, udp bo
 }
 
 // handleIO manages the bidirectional data copy between the connection and Stdin/Stdout.
-// It also monitors the context to close the connection on timeout.
-func handleIO(ctx context.Context, conn net.Conn) error {
-	// Channel to signal when the remote connection is closed
+// It also monitors the context to close the connection on timeout, and applies
+// -N / -q once stdin reaches EOF.
+func handleIO(ctx context.Context, conn net.Conn, opts Options) error {
+	// Channels to signal when the remote connection or stdin is closed
 	remoteDone := make(chan struct{})
+	stdinDone := make(chan struct{})
+	stdin, stdout := os.Stdin, os.Stdout
 
 	// Copy from Connection -> Stdout
 	go func() {
-		_, _ = io.Copy(os.Stdout, conn)
+		_, _ = io.Copy(stdout, conn)
 		// When the remote side closes the connection (or read error), signal completion
 		close(remoteDone)
 	}()
 
 	// Copy from Stdin -> Connection
 	go func() {
-		_, _ = io.Copy(conn, os.Stdin)
-		// Stdin closed. We continue waiting for response from remote.
-		// Note: For TCP, we could optionally CloseWrite() here.
+		_, _ = copyStdin(conn, stdin, opts)
+		close(stdinDone)
 	}()
 
-	// Wait for either context cancellation (timeout) or remote connection close
-	select {
-	case <-ctx.Done():
-		// Context canceled (timeout), close connection to interrupt IO
-		_ = conn.Close()
-		return ctx.Err()
-	case <-remoteDone:
-		// Remote closed connection or Read failed
-		return nil
+	var quit <-chan time.Time
+	for {
+		// Wait for context cancellation (timeout), remote connection close, or stdin EOF
+		select {
+		case <-ctx.Done():
+			// Context canceled (timeout), close connection to interrupt IO
+			_ = conn.Close()
+			return ctx.Err()
+		case <-remoteDone:
+			// Remote closed connection or Read failed
+			return nil
+		case <-stdinDone:
+			// Stdin closed. We continue waiting for response from remote unless -q is set.
+			stdinDone = nil
+			quit = opts.afterStdinEOF(conn)
+		case <-quit:
+			_ = conn.Close()
+			return nil
+		}
+	}
+}
+
+// copyStdin sends stdin to w, a connection or the keep-alive stdin mux. With an
+// interval set it sends one line at a time and pauses between lines, for line
+// protocols that cannot take a burst.
+func copyStdin(w io.Writer, stdin io.Reader, opts Options) (int64, error) {
+	if opts.Interval <= 0 {
+		return io.Copy(w, stdin)
+	}
+
+	r := bufio.NewReader(stdin)
+	var written int64
+	for first := true; ; first = false {
+		line, readErr := r.ReadBytes('\n')
+		if len(line) > 0 {
+			if !first {
+				time.Sleep(opts.Interval)
+			}
+			n, err := w.Write(line)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
 	}
 }
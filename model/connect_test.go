@@ -0,0 +1,329 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStdio replaces os.Stdin with input and captures os.Stdout for the rest of
+// the test. The returned function stops capturing and returns the output.
+func fakeStdio(t *testing.T, input string) func() string {
+	t.Helper()
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(inW, input); err != nil {
+		t.Fatal(err)
+	}
+	inW.Close()
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(&out, outR)
+		close(copied)
+	}()
+
+	oldIn, oldOut := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = inR, outW
+
+	var once sync.Once
+	restore := func() {
+		once.Do(func() {
+			os.Stdin, os.Stdout = oldIn, oldOut
+			inR.Close()
+			outW.Close()
+			<-copied
+		})
+	}
+	t.Cleanup(restore)
+
+	return func() string {
+		restore()
+		return out.String()
+	}
+}
+
+// sessionSides runs the stdin/stdout loop of connect mode and of listen mode.
+var sessionSides = map[string]func(net.Conn, Options) error{
+	"connect": func(conn net.Conn, opts Options) error { return handleIO(context.Background(), conn, opts) },
+	"listen":  func(conn net.Conn, opts Options) error { return handleTCPConnection(conn, false, opts) },
+}
+
+// startSession connects over loopback and runs one side's loop with stdin set
+// to input. It returns the peer's end and the loop's result.
+func startSession(t *testing.T, run func(net.Conn, Options) error, opts Options, input string) (net.Conn, <-chan error, func() string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	peer, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+	_ = peer.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := fakeStdio(t, input)
+	done := make(chan error, 1)
+	go func() { done <- run(opts.wrap(conn), opts) }()
+
+	return peer, done, output
+}
+
+// readUntilEOF reads everything the peer receives and fails when the sender
+// does not close its side within wait.
+func readUntilEOF(t *testing.T, peer net.Conn, wait time.Duration) string {
+	t.Helper()
+
+	_ = peer.SetReadDeadline(time.Now().Add(wait))
+	got, err := io.ReadAll(peer)
+	if err != nil {
+		t.Fatalf("peer saw no EOF: %v (read %q)", err, got)
+	}
+	return string(got)
+}
+
+func TestHalfCloseThroughWrappers(t *testing.T) {
+	opts := Options{
+		HalfClose: true,
+		CRLF:      true,
+		Telnet:    true,
+		HexDump:   io.Discard,
+		RateUp:    1 << 20,
+		Stats:     StatsLive,
+		StatsOut:  io.Discard,
+	}
+
+	for side, run := range sessionSides {
+		t.Run(side, func(t *testing.T) {
+			peer, done, output := startSession(t, run, opts, "hello\n")
+
+			// -N shuts down the sending side under every wrapper.
+			if got := readUntilEOF(t, peer, 2*time.Second); got != "hello\r\n" {
+				t.Errorf("peer got %q", got)
+			}
+
+			// The other direction stays open until the peer is done.
+			if _, err := io.WriteString(peer, "bye\n"); err != nil {
+				t.Fatal(err)
+			}
+			peer.Close()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if got := output(); got != "bye\n" {
+				t.Errorf("stdout = %q", got)
+			}
+		})
+	}
+}
+
+func TestQuitAfterStdinEOF(t *testing.T) {
+	tests := []struct {
+		name  string
+		after time.Duration
+	}{
+		{"q0", 0},
+		{"q300ms", 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for side, run := range sessionSides {
+			t.Run(tt.name+"/"+side, func(t *testing.T) {
+				start := time.Now()
+				peer, done, _ := startSession(t, run, Options{QuitOnEOF: true, QuitAfter: tt.after}, "x\n")
+
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatal(err)
+					}
+				case <-time.After(tt.after + 2*time.Second):
+					t.Fatal("session did not end after stdin EOF")
+				}
+
+				if elapsed := time.Since(start); elapsed < tt.after {
+					t.Errorf("session ended after %v, want at least %v", elapsed, tt.after)
+				}
+				if got := readUntilEOF(t, peer, time.Second); got != "x\n" {
+					t.Errorf("peer got %q", got)
+				}
+			})
+		}
+	}
+}
+
+func TestStdinEOFWaitsForPeer(t *testing.T) {
+	for side, run := range sessionSides {
+		t.Run(side, func(t *testing.T) {
+			peer, done, output := startSession(t, run, Options{}, "x\n")
+
+			buf := make([]byte, 2)
+			if _, err := io.ReadFull(peer, buf); err != nil {
+				t.Fatal(err)
+			}
+
+			// Without -N or -q, stdin EOF neither closes the session nor
+			// half-closes it.
+			_ = peer.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+			var netErr net.Error
+			if _, err := peer.Read(buf); !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Fatalf("peer read = %v, want a timeout", err)
+			}
+			select {
+			case err := <-done:
+				t.Fatalf("session ended on stdin EOF: %v", err)
+			default:
+			}
+
+			if _, err := io.WriteString(peer, "reply\n"); err != nil {
+				t.Fatal(err)
+			}
+			peer.Close()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if got := output(); got != "reply\n" {
+				t.Errorf("stdout = %q", got)
+			}
+		})
+	}
+}
+
+// freePort returns a local TCP port that nothing is listening on.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestSourceAddr(t *testing.T) {
+	tests := []struct {
+		network string
+		opts    Options
+		ipMode  IPMode
+		want    string
+		wantErr bool
+	}{
+		{network: "tcp", opts: Options{SourceAddr: "127.0.0.1", SourcePort: 4000}, want: "127.0.0.1:4000"},
+		{network: "tcp", opts: Options{SourcePort: 4000}, want: ":4000"},
+		{network: "udp6", opts: Options{SourceAddr: "::1"}, ipMode: IPv6Only, want: "[::1]:0"},
+		{network: "tcp4", opts: Options{SourceAddr: "::1"}, ipMode: IPv4Only, wantErr: true},
+		{network: "tcp", opts: Options{SourcePort: 70000}, wantErr: true},
+		{network: "tcp", opts: Options{SourcePort: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		addr, err := sourceAddr(tt.network, tt.opts, tt.ipMode)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("sourceAddr(%s, %q:%d) should fail", tt.network, tt.opts.SourceAddr, tt.opts.SourcePort)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("sourceAddr(%s, %q:%d): %v", tt.network, tt.opts.SourceAddr, tt.opts.SourcePort, err)
+			continue
+		}
+		if addr.Network() != tt.network[:3] || addr.String() != tt.want {
+			t.Errorf("sourceAddr(%s)=%s %s, want %s", tt.network, addr.Network(), addr, tt.want)
+		}
+	}
+}
+
+func TestConnectFromSource(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	remote := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			remote <- err.Error()
+			return
+		}
+		remote <- conn.RemoteAddr().String()
+		conn.Close()
+	}()
+
+	fakeStdio(t, "")
+	source := freePort(t)
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	opts := Options{SourceAddr: "127.0.0.1", SourcePort: source}
+	if err := ConnectWithTimer("127.0.0.1", port, false, false, 5, true, IPv4Only, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// -s and -p are what the peer sees.
+	if got, want := <-remote, "127.0.0.1:"+strconv.Itoa(source); got != want {
+		t.Errorf("peer saw %s, want %s", got, want)
+	}
+}
+
+// timedWriter records every write and when it happened.
+type timedWriter struct {
+	writes []string
+	at     []time.Time
+}
+
+func (w *timedWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	w.at = append(w.at, time.Now())
+	return len(p), nil
+}
+
+func TestCopyStdinInterval(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	var w timedWriter
+
+	n, err := copyStdin(&w, strings.NewReader("one\ntwo\nthree"), Options{Interval: interval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len("one\ntwo\nthree")) {
+		t.Errorf("copied %d bytes", n)
+	}
+
+	// -i sends one line per write, the last one even without a newline.
+	if got := strings.Join(w.writes, "|"); got != "one\n|two\n|three" {
+		t.Errorf("writes = %q", got)
+	}
+	for i := 1; i < len(w.at); i++ {
+		if gap := w.at[i].Sub(w.at[i-1]); gap < interval {
+			t.Errorf("line %d sent %v after the previous one, want at least %v", i, gap, interval)
+		}
+	}
+}
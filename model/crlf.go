@@ -0,0 +1,127 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"net"
+	"sync"
+)
+
+// crlfConn translates line endings for line based protocols. With toCRLF it
+// turns LF into CRLF in sent data (-C); with stripCR it turns CRLF back into
+// LF in received data (--strip-cr).
+type crlfConn struct {
+	net.Conn
+	toCRLF  bool
+	stripCR bool
+	stream  bool
+
+	writeMu sync.Mutex
+	lastCR  bool
+
+	// Read state: a CR that may start a CRLF split across reads, and
+	// converted data, with the error that ended it, waiting for the caller.
+	pendingCR bool
+	buf       []byte
+	unread    []byte
+	readErr   error
+}
+
+func newCRLFConn(conn net.Conn, toCRLF, stripCR bool) *crlfConn {
+	return &crlfConn{Conn: conn, toCRLF: toCRLF, stripCR: stripCR, stream: isStream(conn)}
+}
+
+func (c *crlfConn) Write(p []byte) (int, error) {
+	if !c.toCRLF {
+		return c.Conn.Write(p)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	out := make([]byte, 0, len(p)+len(p)/8)
+	for _, b := range p {
+		// Lines that already end in CRLF are left alone.
+		if b == '\n' && !c.lastCR {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+		c.lastCR = b == '\r'
+	}
+	if !c.stream {
+		c.lastCR = false
+	}
+
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *crlfConn) Read(p []byte) (int, error) {
+	if !c.stripCR || len(p) == 0 {
+		return c.Conn.Read(p)
+	}
+
+	for {
+		// Converted data that did not fit the caller's buffer comes first.
+		if len(c.unread) > 0 {
+			n := copy(p, c.unread)
+			c.unread = c.unread[n:]
+			if len(c.unread) == 0 && c.readErr != nil {
+				err := c.readErr
+				c.readErr = nil
+				return n, err
+			}
+			return n, nil
+		}
+
+		// Read at least two bytes, so even a one-byte buffer sees a whole CRLF.
+		if size := max(len(p)+1, 2); cap(c.buf) < size {
+			c.buf = make([]byte, size)
+		}
+		buf := c.buf[:max(len(p)+1, 2)]
+
+		// A CR held back at the end of the last read goes in front of this one.
+		off := 0
+		if c.pendingCR {
+			buf[0] = '\r'
+			off = 1
+			c.pendingCR = false
+		}
+
+		n, err := c.Conn.Read(buf[off:])
+		data := buf[:off+n]
+
+		out := 0
+		for i, b := range data {
+			if b == '\r' {
+				if i+1 < len(data) && data[i+1] == '\n' {
+					continue
+				}
+				// On a stream the LF may still be on its way.
+				if i+1 == len(data) && err == nil && c.stream {
+					c.pendingCR = true
+					continue
+				}
+			}
+			data[out] = b
+			out++
+		}
+
+		if out > 0 || err != nil {
+			n := copy(p, data[:out])
+			if n == out {
+				return n, err
+			}
+			c.unread, c.readErr = data[n:out], err
+			return n, nil
+		}
+	}
+}
+
+// NetConn returns the wrapped connection.
+func (c *crlfConn) NetConn() net.Conn {
+	return c.Conn
+}
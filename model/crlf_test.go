@@ -0,0 +1,62 @@
+package model
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestCRLFConnWrite(t *testing.T) {
+	local, remote := net.Pipe()
+	conn := newCRLFConn(local, true, false)
+	// net.Pipe is not recognised as a stream; treat it like TCP.
+	conn.stream = true
+
+	go func() {
+		for _, chunk := range []string{"HELO a\n", "DATA\r", "\nQUIT\n"} {
+			_, _ = conn.Write([]byte(chunk))
+		}
+		_ = conn.Close()
+	}()
+
+	got, _ := io.ReadAll(remote)
+	if want := "HELO a\r\nDATA\r\nQUIT\r\n"; string(got) != want {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestCRLFConnStripCR(t *testing.T) {
+	// Small buffers must not let a CRLF through unconverted.
+	for _, size := range []int{1, 2, 3, 512} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			local, remote := net.Pipe()
+			conn := newCRLFConn(local, false, true)
+			conn.stream = true
+
+			go func() {
+				// The CRLF of the first line is split across two writes.
+				for _, chunk := range []string{"220 ready\r", "\n250 ok\r\n", "bare\rcr\r"} {
+					_, _ = remote.Write([]byte(chunk))
+				}
+				_ = remote.Close()
+			}()
+
+			var got []byte
+			buf := make([]byte, size)
+			for {
+				n, err := conn.Read(buf)
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if want := "220 ready\n250 ok\nbare\rcr\r"; string(got) != want {
+				t.Errorf("received %q, want %q", got, want)
+			}
+		})
+	}
+}
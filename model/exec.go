@@ -0,0 +1,82 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runExec starts the program configured in opts with its stdin, stdout and
+// stderr wired to conn. It returns once the program has exited.
+func runExec(ctx context.Context, conn net.Conn, opts Options) error {
+	cmd, err := buildCommand(ctx, opts)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(), execEnv(conn)...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	// Share the stdout pipe so the peer also sees what the program writes to stderr.
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("exec failed: %w", err)
+	}
+
+	// Copy from Connection -> program stdin
+	go func() {
+		_, _ = io.Copy(stdin, conn)
+		// Remote closed; let the program see EOF on its stdin.
+		_ = stdin.Close()
+	}()
+
+	// Copy from program stdout/stderr -> Connection until the program exits
+	_, _ = io.Copy(conn, stdout)
+	_ = conn.Close()
+
+	return cmd.Wait()
+}
+
+// buildCommand turns the -e/-c setting into an *exec.Cmd bound to ctx.
+func buildCommand(ctx context.Context, opts Options) (*exec.Cmd, error) {
+	if opts.ShellExec {
+		return exec.CommandContext(ctx, "/bin/sh", "-c", opts.Exec), nil
+	}
+
+	fields := strings.Fields(opts.Exec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("missing program to execute")
+	}
+
+	return exec.CommandContext(ctx, fields[0], fields[1:]...), nil
+}
+
+// execEnv describes the connection to the child process using the same
+// variable names as ncat.
+func execEnv(conn net.Conn) []string {
+	var env []string
+
+	if host, port, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		env = append(env, "NCAT_REMOTE_ADDR="+host, "NCAT_REMOTE_PORT="+port)
+	}
+	if host, port, err := net.SplitHostPort(conn.LocalAddr().String()); err == nil {
+		env = append(env, "NCAT_LOCAL_ADDR="+host, "NCAT_LOCAL_PORT="+port)
+	}
+	env = append(env, "NCAT_PROTO="+strings.ToUpper(conn.LocalAddr().Network()))
+
+	return env
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// execPair runs opts' program on the accepted side of a loopback connection
+// and returns the client side together with runExec's result.
+func execPair(t *testing.T, opts Options) (net.Conn, <-chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- runExec(context.Background(), conn, opts)
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return client, done
+}
+
+func TestRunExecRoundTrip(t *testing.T) {
+	client, done := execPair(t, Options{Exec: "cat"})
+
+	if _, err := io.WriteString(client, "hello exec\n"); err != nil {
+		t.Fatal(err)
+	}
+	// EOF on the child's stdin makes cat exit.
+	if err := closeWrite(client); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello exec\n" {
+		t.Errorf("got %q, want %q", got, "hello exec\n")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("runExec: %v", err)
+	}
+}
+
+func TestRunExecShell(t *testing.T) {
+	client, done := execPair(t, Options{Exec: `echo "$NCAT_PROTO $NCAT_REMOTE_ADDR"; echo oops >&2; exit 3`, ShellExec: true})
+
+	got, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "TCP 127.0.0.1\noops\n" {
+		t.Errorf("got %q", got)
+	}
+
+	var exitErr *exec.ExitError
+	if err := <-done; !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("runExec = %v, want exit status 3", err)
+	}
+}
+
+func TestBuildCommandEmpty(t *testing.T) {
+	if _, err := buildCommand(context.Background(), Options{Exec: "  "}); err == nil {
+		t.Error("empty -e should be rejected")
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	dumpSent     = '>'
+	dumpReceived = '<'
+)
+
+// dumpMu serializes hex dump output so chunks from concurrent connections never interleave.
+var dumpMu sync.Mutex
+
+// hexDumper writes traffic in `hexdump -C` layout, prefixing every line with a
+// direction marker. Offsets are tracked separately for each direction.
+type hexDumper struct {
+	w        io.Writer
+	sent     int64
+	received int64
+}
+
+func newHexDumper(w io.Writer) *hexDumper {
+	return &hexDumper{w: w}
+}
+
+// dump writes one chunk of traffic travelling in direction dir.
+func (d *hexDumper) dump(dir byte, p []byte) {
+	dumpMu.Lock()
+	defer dumpMu.Unlock()
+
+	offset := &d.received
+	if dir == dumpSent {
+		offset = &d.sent
+	}
+
+	var buf bytes.Buffer
+	formatHexDump(&buf, dir, *offset, p)
+	*offset += int64(len(p))
+
+	_, _ = d.w.Write(buf.Bytes())
+}
+
+// formatHexDump renders p as `hexdump -C` lines starting at offset.
+func formatHexDump(buf *bytes.Buffer, dir byte, offset int64, p []byte) {
+	for start := 0; start < len(p); start += 16 {
+		end := min(start+16, len(p))
+		line := p[start:end]
+
+		fmt.Fprintf(buf, "%c %08x  ", dir, offset+int64(start))
+		for i := 0; i < 16; i++ {
+			if i < len(line) {
+				fmt.Fprintf(buf, "%02x ", line[i])
+			} else {
+				buf.WriteString("   ")
+			}
+			if i == 7 {
+				buf.WriteByte(' ')
+			}
+		}
+
+		buf.WriteString(" |")
+		for _, b := range line {
+			if b >= 0x20 && b < 0x7f {
+				buf.WriteByte(b)
+			} else {
+				buf.WriteByte('.')
+			}
+		}
+		buf.WriteString("|\n")
+	}
+}
+
+// dumpConn hex dumps everything read from and written to the wrapped connection.
+type dumpConn struct {
+	net.Conn
+	dumper *hexDumper
+}
+
+func (c *dumpConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.dumper.dump(dumpReceived, p[:n])
+	}
+	return n, err
+}
+
+func (c *dumpConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.dumper.dump(dumpSent, p[:n])
+	}
+	return n, err
+}
+
+// NetConn returns the wrapped connection.
+func (c *dumpConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatHexDump(t *testing.T) {
+	tests := []struct {
+		name   string
+		dir    byte
+		offset int64
+		data   []byte
+		want   string
+	}{
+		{
+			name: "short line is padded",
+			dir:  dumpSent,
+			data: []byte("Hello, world\n"),
+			want: "> 00000000  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 0a           |Hello, world.|\n",
+		},
+		{
+			name:   "continues from offset across lines",
+			dir:    dumpReceived,
+			offset: 0x20,
+			data:   append(bytes.Repeat([]byte{0x41}, 16), 0x00, 0xff),
+			want: "< 00000020  41 41 41 41 41 41 41 41  41 41 41 41 41 41 41 41  |AAAAAAAAAAAAAAAA|\n" +
+				"< 00000030  00 ff                                             |..|\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			formatHexDump(&buf, tt.dir, tt.offset, tt.data)
+			if got := buf.String(); got != tt.want {
+				t.Fatalf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHexDumperOffsetsPerDirection(t *testing.T) {
+	var buf bytes.Buffer
+	d := newHexDumper(&buf)
+
+	d.dump(dumpSent, []byte("ab"))
+	d.dump(dumpReceived, []byte("c"))
+	d.dump(dumpSent, []byte("d"))
+
+	want := "> 00000000  61 62                                             |ab|\n" +
+		"< 00000000  63                                                |c|\n" +
+		"> 00000002  64                                                |d|\n"
+	if buf.String() != want {
+		t.Fatalf("got\n%q\nwant\n%q", buf.String(), want)
+	}
+}
@@ -4,34 +4,95 @@ Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
 package model
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"strconv"
 	"sync"
+	"time"
 )
 
 // Listen starts a TCP/UDP listener with optional source filtering and keep-alive behavior.
-func Listen(port int, verbose bool, udp bool, keepOpen bool, source string, ipMode IPMode) error {
+// When opts.Exec is set, every accepted connection or UDP peer is handed to a new child process.
+// When opts.Unix is set, port, udp, source and ipMode are ignored and the listener
+// is bound to the Unix domain socket instead.
+func Listen(port int, verbose bool, udp bool, keepOpen bool, source string, ipMode IPMode, opts Options) error {
+	datagram := udp
+	if opts.Unix != nil {
+		datagram = opts.Unix.Type == "unixgram"
+	}
+	if datagram && opts.TLS != nil {
+		return fmt.Errorf("TLS cannot be used over datagram sockets")
+	}
+
+	if datagram && opts.transferring() {
+		return fmt.Errorf("file transfer requires a stream socket")
+	}
+
+	if opts.Broker || opts.Chat {
+		if datagram {
+			return fmt.Errorf("broker mode requires a stream socket")
+		}
+		if opts.Exec != "" {
+			return fmt.Errorf("cannot combine broker mode with -e/-c")
+		}
+		// Brokering only makes sense with several clients connected at once.
+		keepOpen = true
+	}
+
+	var tlsConfig *tls.Config
+	if opts.TLS != nil {
+		var err error
+		if tlsConfig, err = opts.TLS.serverConfig(verbose); err != nil {
+			return err
+		}
+	}
+
+	if opts.Unix != nil {
+		cfg := listenConfig{verbose: verbose, keepOpen: keepOpen, opts: opts, tlsConfig: tlsConfig}
+		cfg.broker = cfg.newBroker()
+		cfg.mux = cfg.newStdinMux()
+		return listenUnix(cfg)
+	}
+
 	if err := validatePort(port); err != nil {
 		return err
 	}
 
+	if err := ipMode.ValidateHost(opts.BindHost, false); err != nil {
+		return err
+	}
+
 	allowedIP, err := resolveSource(source, ipMode)
 	if err != nil {
 		return err
 	}
 
+	var lc net.ListenConfig
+	if opts.Interface != "" {
+		if lc.Control, err = bindToDevice(opts.Interface); err != nil {
+			return err
+		}
+	}
+
 	cfg := listenConfig{
 		port:      port,
 		verbose:   verbose,
 		keepOpen:  keepOpen,
 		allowedIP: allowedIP,
 		ipMode:    ipMode,
+		opts:      opts,
+		tlsConfig: tlsConfig,
+		lc:        lc,
 	}
+	cfg.broker = cfg.newBroker()
+	cfg.mux = cfg.newStdinMux()
 
-	announceMode(cfg.port, udp, ipMode)
+	announceMode(cfg.address(), udp, ipMode)
 
 	if udp {
 		return listenUDP(cfg)
@@ -46,6 +107,33 @@ type listenConfig struct {
 	keepOpen  bool
 	allowedIP net.IP
 	ipMode    IPMode
+	opts      Options
+	tlsConfig *tls.Config
+	broker    *broker
+	mux       *stdinMux
+	lc        net.ListenConfig
+}
+
+// address is the local host:port the listener binds to; an empty host means all interfaces.
+func (cfg listenConfig) address() string {
+	return net.JoinHostPort(cfg.opts.BindHost, strconv.Itoa(cfg.port))
+}
+
+func (cfg listenConfig) newBroker() *broker {
+	if !cfg.opts.Broker && !cfg.opts.Chat {
+		return nil
+	}
+
+	return newBroker(cfg.opts.Chat, cfg.verbose)
+}
+
+// newStdinMux shares stdin between concurrent clients in keep-alive mode.
+func (cfg listenConfig) newStdinMux() *stdinMux {
+	if !cfg.keepOpen || cfg.broker != nil || cfg.opts.Exec != "" || cfg.opts.transferring() {
+		return nil
+	}
+
+	return newStdinMux(cfg.opts, cfg.verbose)
 }
 
 func validatePort(port int) error {
@@ -69,7 +157,7 @@ func resolveSource(source string, ipMode IPMode) (net.IP, error) {
 	return addr.IP, nil
 }
 
-func announceMode(port int, udp bool, ipMode IPMode) {
+func announceMode(address string, udp bool, ipMode IPMode) {
 	protocol := "TCP"
 	if udp {
 		protocol = "UDP"
@@ -82,71 +170,150 @@ func announceMode(port int, udp bool, ipMode IPMode) {
 		family = "IPv6"
 	}
 
-	fmt.Printf("Listening on port %d (%s, %s)\n", port, protocol, family)
+	host, port, _ := net.SplitHostPort(address)
+	if host == "" {
+		fmt.Fprintf(os.Stderr, "Listening on port %s (%s, %s)\n", port, protocol, family)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s (%s, %s)\n", address, protocol, family)
 }
 
-func (cfg listenConfig) allowed(addr net.IP) bool {
-	if cfg.allowedIP == nil {
-		return true
+// admit reports whether a peer may connect and, when it may not, the rule that rejected it.
+func (cfg listenConfig) admit(addr net.IP) (bool, string) {
+	// Unix socket peers have no IP address to filter on.
+	if addr == nil {
+		return true, ""
+	}
+
+	if cfg.allowedIP != nil && !cfg.allowedIP.Equal(addr) {
+		return false, "source " + cfg.allowedIP.String()
+	}
+
+	if cfg.opts.Access != nil {
+		return cfg.opts.Access.Check(addr)
 	}
 
-	return cfg.allowedIP.Equal(addr)
+	return true, ""
 }
 
 func listenUDP(cfg listenConfig) error {
-	network := cfg.ipMode.Network(true)
-
-	addr, err := net.ResolveUDPAddr(network, ":"+strconv.Itoa(cfg.port))
+	pc, err := cfg.lc.ListenPacket(context.Background(), cfg.ipMode.Network(true), cfg.address())
 	if err != nil {
 		return err
 	}
 
-	conn, err := net.ListenUDP(network, addr)
-	if err != nil {
-		return err
-	}
+	return cfg.servePackets(pc)
+}
+
+// servePackets demultiplexes datagrams into per-peer sessions that are served
+// like TCP connections, so the listener can answer its peers. Without -k it
+// locks onto the first allowed peer and ignores everyone else: a UDP socket
+// is connected to that peer so the kernel drops other datagrams, and the
+// check here covers Unix datagram sockets and what was queued before.
+func (cfg listenConfig) servePackets(conn net.PacketConn) error {
 	defer conn.Close()
 
-	buf := make([]byte, 4096)
+	var mu sync.Mutex
+	sessions := make(map[string]*udpSession)
+	var locked net.Addr
+	result := make(chan error, 1)
+
+	buf := make([]byte, 65536)
 
 	for {
-		n, remote, err := conn.ReadFromUDP(buf)
+		n, remote, err := conn.ReadFrom(buf)
 		if err != nil {
+			// Without -k the socket is closed once the single session ends.
+			select {
+			case serveErr := <-result:
+				return serveErr
+			default:
+			}
 			if cfg.verbose {
-				fmt.Fprintf(os.Stderr, "udp read error: %v\n", err)
+				fmt.Fprintf(os.Stderr, "%s read error: %v\n", conn.LocalAddr().Network(), err)
 			}
-			if !cfg.keepOpen {
+			if !cfg.keepOpen || errors.Is(err, net.ErrClosed) {
 				return err
 			}
 			continue
 		}
+		if remote == nil {
+			// An unbound Unix datagram sender: it is heard but cannot be answered.
+			remote = &net.UnixAddr{Net: conn.LocalAddr().Network()}
+		}
 
-		if !cfg.allowed(remote.IP) {
-			if cfg.verbose {
-				fmt.Fprintf(os.Stderr, "ignored packet from %s\n", remote.IP.String())
+		if ip := extractIP(remote); ip != nil {
+			if ok, rule := cfg.admit(ip); !ok {
+				fmt.Fprintf(os.Stderr, "ignored packet from %s (%s)\n", ip.String(), rule)
+				continue
 			}
-			if !cfg.keepOpen {
-				return nil
+		}
+
+		if locked != nil && locked.String() != remote.String() {
+			if cfg.verbose {
+				fmt.Fprintf(os.Stderr, "ignored packet from %s, locked to %s\n", remote.String(), locked.String())
 			}
 			continue
 		}
 
-		if _, err := os.Stdout.Write(buf[:n]); err != nil {
-			return err
-		}
+		key := remote.String()
+		mu.Lock()
+		session, ok := sessions[key]
+		mu.Unlock()
 
-		if !cfg.keepOpen {
-			return nil
+		if !ok {
+			idle := cfg.opts.UDPIdle
+			if !cfg.keepOpen {
+				// A single session lasts as long as the listener does.
+				idle = 0
+				locked = remote
+			}
+
+			session = newUDPSession(conn, remote, idle, func() {
+				mu.Lock()
+				delete(sessions, key)
+				mu.Unlock()
+			})
+			if !cfg.keepOpen {
+				if err := connectPeer(conn, remote); err == nil {
+					session.connected = true
+				} else if cfg.verbose && !errors.Is(err, errors.ErrUnsupported) {
+					fmt.Fprintf(os.Stderr, "cannot connect socket to %s: %v\n", remote.String(), err)
+				}
+			}
+			mu.Lock()
+			sessions[key] = session
+			mu.Unlock()
+
+			if cfg.keepOpen {
+				go func() {
+					if err := cfg.serve(session); err != nil && cfg.verbose {
+						fmt.Fprintf(os.Stderr, "session error: %v\n", err)
+					}
+				}()
+			} else {
+				go func() {
+					result <- cfg.serve(session)
+					_ = conn.Close()
+				}()
+			}
 		}
+
+		session.deliver(append([]byte(nil), buf[:n]...))
 	}
 }
 
 func listenTCP(cfg listenConfig) error {
-	ln, err := net.Listen(cfg.ipMode.Network(false), ":"+strconv.Itoa(cfg.port))
+	ln, err := cfg.lc.Listen(context.Background(), cfg.ipMode.Network(false), cfg.address())
 	if err != nil {
 		return err
 	}
 
+	return cfg.acceptLoop(ln)
+}
+
+// acceptLoop accepts connections on ln, filtering peers and serving each one.
+func (cfg listenConfig) acceptLoop(ln net.Listener) error {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -160,10 +327,8 @@ func listenTCP(cfg listenConfig) error {
 		}
 
 		remoteIP := extractIP(conn.RemoteAddr())
-		if !cfg.allowed(remoteIP) {
-			if cfg.verbose {
-				fmt.Fprintf(os.Stderr, "rejected connection from %s\n", remoteIP.String())
-			}
+		if ok, rule := cfg.admit(remoteIP); !ok {
+			fmt.Fprintf(os.Stderr, "rejected connection from %s (%s)\n", remoteIP.String(), rule)
 			_ = conn.Close()
 			if !cfg.keepOpen {
 				return nil
@@ -171,40 +336,91 @@ func listenTCP(cfg listenConfig) error {
 			continue
 		}
 
-		printConnectionInfo(conn)
-
 		if cfg.keepOpen {
-			go handleTCPConnection(conn, cfg.verbose)
+			go func() {
+				if err := cfg.serve(conn); err != nil && cfg.verbose {
+					fmt.Fprintf(os.Stderr, "connection error: %v\n", err)
+				}
+			}()
 			continue
 		}
 
-		return handleTCPConnection(conn, cfg.verbose)
+		return cfg.serve(conn)
 	}
 }
 
-func handleTCPConnection(conn net.Conn, verbose bool) error {
-	var once sync.Once
-	closeConn := func() { _ = conn.Close() }
+// serve handles one accepted connection through a child process, a file transfer or stdin/stdout.
+func (cfg listenConfig) serve(conn net.Conn) error {
+	if cfg.tlsConfig != nil {
+		tlsConn, err := tlsServer(conn, cfg.tlsConfig, cfg.opts.TLS.HandshakeTimeout, cfg.verbose)
+		if err != nil {
+			_ = conn.Close()
+			return err
+		}
+		conn = tlsConn
+	}
+
+	printConnectionInfo(conn)
 
-	done := make(chan struct{})
+	conn = cfg.opts.wrap(conn)
+
+	if cfg.broker != nil {
+		return cfg.broker.serve(conn)
+	}
+
+	if cfg.opts.Exec != "" {
+		defer conn.Close()
+		return runExec(context.Background(), conn, cfg.opts)
+	}
+
+	if cfg.opts.transferring() {
+		return cfg.opts.runTransfer(conn)
+	}
+
+	if cfg.mux != nil {
+		return cfg.mux.serve(conn)
+	}
+
+	return handleTCPConnection(conn, cfg.verbose, cfg.opts)
+}
+
+// handleTCPConnection copies between an accepted connection and Stdin/Stdout
+// until the peer closes. Stdin EOF alone does not end the session, so a
+// listener with empty stdin still receives everything; -N and -q decide what
+// happens to the sending side.
+func handleTCPConnection(conn net.Conn, verbose bool, opts Options) error {
+	defer conn.Close()
+
+	remoteDone := make(chan struct{})
+	stdinDone := make(chan struct{})
+	stdin, stdout := os.Stdin, os.Stdout
 
 	go func() {
-		if _, err := io.Copy(conn, os.Stdin); err != nil && verbose {
+		if _, err := copyStdin(conn, stdin, opts); err != nil && verbose && !errors.Is(err, net.ErrClosed) {
 			fmt.Fprintf(os.Stderr, "error sending data: %v\n", err)
 		}
-		once.Do(closeConn)
+		close(stdinDone)
 	}()
 
 	go func() {
-		if _, err := io.Copy(os.Stdout, conn); err != nil && verbose {
+		if _, err := io.Copy(stdout, conn); err != nil && verbose && !errors.Is(err, net.ErrClosed) {
 			fmt.Fprintf(os.Stderr, "error receiving data: %v\n", err)
 		}
-		once.Do(closeConn)
-		close(done)
+		close(remoteDone)
 	}()
 
-	<-done
-	return nil
+	var quit <-chan time.Time
+	for {
+		select {
+		case <-remoteDone:
+			return nil
+		case <-stdinDone:
+			stdinDone = nil
+			quit = opts.afterStdinEOF(conn)
+		case <-quit:
+			return nil
+		}
+	}
 }
 
 func extractIP(addr net.Addr) net.IP {
@@ -218,10 +434,24 @@ func extractIP(addr net.Addr) net.IP {
 	}
 }
 
+// printConnectionInfo reports a new peer on stderr, keeping stdout for received data.
 func printConnectionInfo(conn net.Conn) {
-	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
-		fmt.Printf("Connection from %s %d\n", addr.IP.String(), addr.Port)
+	identity := ""
+	if id := peerIdentity(conn); id != "" {
+		identity = " as " + id
+	}
+
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		fmt.Fprintf(os.Stderr, "Connection from %s %d%s\n", addr.IP.String(), addr.Port, identity)
+		return
+	case *net.UDPAddr:
+		fmt.Fprintf(os.Stderr, "Connection from %s %d\n", addr.IP.String(), addr.Port)
+		return
+	}
+	if addr, ok := conn.LocalAddr().(*net.UnixAddr); ok {
+		fmt.Fprintf(os.Stderr, "Connection on %s%s\n", addr.Name, identity)
 		return
 	}
-	fmt.Printf("Connection from %s\n", conn.RemoteAddr().String())
+	fmt.Fprintf(os.Stderr, "Connection from %s%s\n", conn.RemoteAddr().String(), identity)
 }
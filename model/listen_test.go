@@ -0,0 +1,184 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// servePacketsLoopback runs cfg's datagram loop on a loopback UDP socket and
+// returns its address. The loop is stopped when the test ends.
+func servePacketsLoopback(t *testing.T, cfg listenConfig) *net.UDPAddr {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = cfg.servePackets(pc)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		pc.Close()
+		<-done
+	})
+
+	return pc.LocalAddr().(*net.UDPAddr)
+}
+
+// udpPeer is a client socket that talks to the listener.
+func udpPeer(t *testing.T, server *net.UDPAddr) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.DialUDP("udp4", nil, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// exchange sends msg and returns what comes back within wait, joined up.
+func exchange(t *testing.T, conn *net.UDPConn, msg string, wait time.Duration) string {
+	t.Helper()
+
+	if msg != "" {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got bytes.Buffer
+	buf := make([]byte, 1500)
+	deadline := time.Now().Add(wait)
+	for {
+		_ = conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return got.String()
+		}
+		got.Write(buf[:n])
+	}
+}
+
+func TestServePacketsSessionPerPeer(t *testing.T) {
+	// Every peer gets its own child, which answers one line and exits.
+	server := servePacketsLoopback(t, listenConfig{
+		keepOpen: true,
+		opts:     Options{Exec: `read line; echo "$line $NCAT_REMOTE_PORT"`, ShellExec: true},
+	})
+
+	a, b := udpPeer(t, server), udpPeer(t, server)
+	if _, err := a.Write([]byte("from a\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	gotB := exchange(t, b, "from b\n", 500*time.Millisecond)
+	gotA := exchange(t, a, "", 500*time.Millisecond)
+
+	for name, tt := range map[string]struct {
+		got  string
+		conn *net.UDPConn
+		want string
+	}{
+		"a": {gotA, a, "from a"},
+		"b": {gotB, b, "from b"},
+	} {
+		want := tt.want + " " + strconv.Itoa(tt.conn.LocalAddr().(*net.UDPAddr).Port) + "\n"
+		if tt.got != want {
+			t.Errorf("peer %s got %q, want %q", name, tt.got, want)
+		}
+	}
+}
+
+func TestServePacketsLocksFirstPeer(t *testing.T) {
+	server := servePacketsLoopback(t, listenConfig{
+		opts: Options{Exec: `while read line; do echo "got $line"; done`, ShellExec: true},
+	})
+
+	first, other := udpPeer(t, server), udpPeer(t, server)
+	if got := exchange(t, first, "one\n", 500*time.Millisecond); got != "got one\n" {
+		t.Fatalf("first peer got %q", got)
+	}
+
+	// Without -k everyone but the first peer is ignored.
+	if got := exchange(t, other, "intruder\n", 300*time.Millisecond); got != "" {
+		t.Errorf("other peer got %q", got)
+	}
+	if got := exchange(t, first, "two\n", 500*time.Millisecond); got != "got two\n" {
+		t.Errorf("first peer got %q after the other peer wrote", got)
+	}
+}
+
+func TestServePacketsIdleExpiry(t *testing.T) {
+	// The child greets each new session and lives until the session closes.
+	server := servePacketsLoopback(t, listenConfig{
+		keepOpen: true,
+		opts:     Options{Exec: `echo hello; cat`, ShellExec: true, UDPIdle: 500 * time.Millisecond},
+	})
+
+	peer := udpPeer(t, server)
+	if got := exchange(t, peer, "x\n", 200*time.Millisecond); got != "hello\nx\n" {
+		t.Fatalf("first datagram: got %q", got)
+	}
+	if got := exchange(t, peer, "y\n", 100*time.Millisecond); got != "y\n" {
+		t.Fatalf("same session: got %q", got)
+	}
+
+	// After --udp-idle without traffic the session is gone, and the next
+	// datagram starts a new one.
+	time.Sleep(time.Second)
+	if got := exchange(t, peer, "z\n", 200*time.Millisecond); got != "hello\nz\n" {
+		t.Errorf("after idle timeout: got %q", got)
+	}
+}
+
+func TestConnectPeerFilters(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	server := pc.LocalAddr().(*net.UDPAddr)
+
+	first, other := udpPeer(t, server), udpPeer(t, server)
+	if err := connectPeer(pc, first.LocalAddr()); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("connected listening sockets are not supported here")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	// The kernel now drops datagrams from anyone but the first peer.
+	if _, err := other.Write([]byte("intruder")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64)
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, from, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "first" || from.String() != first.LocalAddr().String() {
+		t.Errorf("read %q from %s", buf[:n], from)
+	}
+
+	// Replies on the connected socket reach the peer.
+	session := newUDPSession(pc, first.LocalAddr(), 0, nil)
+	session.connected = true
+	if _, err := session.Write([]byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	if got := exchange(t, first, "", 500*time.Millisecond); got != "reply" {
+		t.Errorf("peer got %q", got)
+	}
+}
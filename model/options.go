@@ -0,0 +1,145 @@
+package model
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Options carries the settings that shape how an established connection is
+// handled. It is shared by connect and listen modes.
+type Options struct {
+	// Exec is a program to run for each connection in place of stdin/stdout.
+	Exec string
+	// ShellExec runs Exec through /bin/sh -c instead of splitting it on whitespace.
+	ShellExec bool
+	// HexDump, when non-nil, receives a hex dump of all traffic in both directions.
+	HexDump io.Writer
+	// Proxy, when non-nil, tunnels outbound TCP connections through a proxy.
+	Proxy *Proxy
+	// Telnet answers telnet option negotiation and strips it from received data.
+	Telnet bool
+	// Broker makes a listener relay data between all connected clients instead of stdin/stdout.
+	Broker bool
+	// Chat is a broker variant that relays whole lines prefixed with the sender's address.
+	Chat bool
+	// StdinPolicy decides which keep-alive (-k) clients receive stdin.
+	StdinPolicy StdinPolicy
+	// UDPIdle closes a keep-alive UDP listener session after this long without traffic; zero never expires.
+	UDPIdle time.Duration
+	// HalfClose shuts down the sending side of the connection once stdin reaches EOF (-N).
+	HalfClose bool
+	// QuitOnEOF closes the connection QuitAfter after stdin reaches EOF (-q).
+	QuitOnEOF bool
+	QuitAfter time.Duration
+	// SourceAddr and SourcePort bind outbound connections to a local address (-s)
+	// and port (-p). Zero values let the system choose.
+	SourceAddr string
+	SourcePort int
+	// Access, when non-nil, filters the peers a listener accepts.
+	Access *AccessList
+	// BindHost is the local address a listener binds to, including an optional
+	// IPv6 zone such as fe80::1%eth0. Empty means all addresses.
+	BindHost string
+	// Interface pins listening sockets to a network interface (SO_BINDTODEVICE, Linux only).
+	Interface string
+	// TLS, when non-nil, secures the connection with TLS.
+	TLS *TLSOptions
+	// Unix, when non-nil, replaces the host/port address with a Unix domain socket.
+	Unix *UnixSocket
+	// SendFile offers this file to the peer with the --send transfer protocol instead of piping stdin.
+	SendFile string
+	// RecvDir stores a file offered by the peer in this directory instead of writing to stdout.
+	RecvDir string
+	// SendDir streams the contents of this directory to the peer as a tar archive (--send-dir).
+	SendDir string
+	// ExtractDir unpacks a tar archive sent with --send-dir into this directory (--recv-dir).
+	ExtractDir string
+	// Compression applies to the tar stream written by SendDir; the receiver detects it.
+	Compression Compression
+	// Stats reports bytes and throughput of each connection on StatsOut (--stats, --stats-json).
+	Stats    StatsMode
+	StatsOut io.Writer
+	// RateUp and RateDown limit sending and receiving to this many bytes per second; zero is unlimited.
+	RateUp   int64
+	RateDown int64
+	// Interval sends stdin one line at a time with this delay between lines (-i).
+	Interval time.Duration
+	// CRLF sends LF line endings as CRLF (-C); StripCR turns received CRLF back into LF.
+	CRLF    bool
+	StripCR bool
+}
+
+// ScanOptions carries optional settings for port scan mode.
+type ScanOptions struct {
+	// Proxy, when non-nil, tunnels TCP probes through a proxy.
+	Proxy *Proxy
+	// Interval is the delay between consecutive probes (-i).
+	Interval time.Duration
+	// Format selects how results are reported (--output-format).
+	Format ScanFormat
+	// Output, when non-nil, receives the report (-o) while live text lines still go to stdout.
+	Output io.Writer
+	// Banner reads what open TCP ports send first (--banner), after writing
+	// BannerProbe when it is set. The probe may contain \r, \n and \xNN escapes.
+	Banner      bool
+	BannerProbe string
+	// Services, when non-nil, identifies the service and version behind open
+	// TCP ports by sending its probes and matching the answers (--service).
+	Services *ServiceDB
+	// UDPPayloads adds payloads for UDP scans as PORTS:PAYLOAD (--udp-payload),
+	// sent along with the built-in probes for those ports.
+	UDPPayloads []string
+
+	probe     []byte
+	udpProbes *ServiceDB
+}
+
+// wrap layers the configured stream features on top of an established connection.
+func (o Options) wrap(conn net.Conn) net.Conn {
+	if o.Stats != StatsOff {
+		conn = newStatsConn(conn, o.Stats, o.StatsOut)
+	}
+	if o.RateUp > 0 || o.RateDown > 0 {
+		conn = newLimitConn(conn, o.RateUp, o.RateDown)
+	}
+	if o.HexDump != nil {
+		conn = &dumpConn{Conn: conn, dumper: newHexDumper(o.HexDump)}
+	}
+	if o.Telnet {
+		conn = &telnetConn{Conn: conn}
+	}
+	if o.CRLF || o.StripCR {
+		conn = newCRLFConn(conn, o.CRLF, o.StripCR)
+	}
+
+	return conn
+}
+
+// afterStdinEOF applies -N and -q once stdin is exhausted. The returned channel
+// fires when the connection should be closed; it is nil to keep waiting for the peer.
+func (o Options) afterStdinEOF(conn net.Conn) <-chan time.Time {
+	if o.HalfClose {
+		_ = closeWrite(conn)
+	}
+	if o.QuitOnEOF {
+		return time.After(o.QuitAfter)
+	}
+	return nil
+}
+
+// closeWrite shuts down the sending half of conn, looking through the stream
+// wrappers for a transport that supports it.
+func closeWrite(conn net.Conn) error {
+	for {
+		switch c := conn.(type) {
+		case interface{ CloseWrite() error }:
+			return c.CloseWrite()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return errors.ErrUnsupported
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// progress renders a single self-updating status line for a transfer of a known size.
+type progress struct {
+	label string
+	total int64
+	done  atomic.Int64
+	start time.Time
+	out   io.Writer
+	stop  chan struct{}
+	ended chan struct{}
+}
+
+// startProgress redraws the status line on out every refresh interval until finish is called.
+func startProgress(out io.Writer, label string, total, offset int64) *progress {
+	p := &progress{
+		label: label,
+		total: total,
+		start: time.Now(),
+		out:   out,
+		stop:  make(chan struct{}),
+		ended: make(chan struct{}),
+	}
+	p.done.Store(offset)
+
+	go func() {
+		defer close(p.ended)
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.render()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// Write counts bytes, so a progress can sit behind an io.TeeReader or io.MultiWriter.
+func (p *progress) Write(b []byte) (int, error) {
+	p.done.Add(int64(len(b)))
+	return len(b), nil
+}
+
+func (p *progress) render() {
+	done := p.done.Load()
+	percent := 100.0
+	if p.total > 0 {
+		percent = float64(done) * 100 / float64(p.total)
+	}
+	fmt.Fprintf(p.out, "\r%s: %s / %s (%.1f%%)", p.label, formatBytes(done), formatBytes(p.total), percent)
+}
+
+// finish draws the final state and ends the status line.
+func (p *progress) finish() {
+	close(p.stop)
+	<-p.ended
+	p.render()
+	fmt.Fprintf(p.out, " in %s\n", time.Since(p.start).Round(time.Millisecond))
+}
+
+// formatBytes renders n with a binary unit suffix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
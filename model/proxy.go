@@ -0,0 +1,337 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProxyType selects the protocol spoken to an outbound proxy.
+type ProxyType int
+
+const (
+	// ProxyHTTP tunnels through an HTTP proxy with the CONNECT method.
+	ProxyHTTP ProxyType = iota
+	// ProxySOCKS4 resolves the target locally and asks a SOCKS4 proxy for an IPv4 connection.
+	ProxySOCKS4
+	// ProxySOCKS4A lets a SOCKS4a proxy resolve the target hostname.
+	ProxySOCKS4A
+	// ProxySOCKS5 speaks SOCKS5 with optional username/password authentication.
+	ProxySOCKS5
+)
+
+// String returns the name used for the proxy type on the command line.
+func (t ProxyType) String() string {
+	switch t {
+	case ProxySOCKS4:
+		return "socks4"
+	case ProxySOCKS4A:
+		return "socks4a"
+	case ProxySOCKS5:
+		return "socks5"
+	default:
+		return "http"
+	}
+}
+
+// Proxy describes an outbound proxy that TCP connections are tunnelled through.
+type Proxy struct {
+	Address  string
+	Type     ProxyType
+	Username string
+	Password string
+}
+
+// contextDialer is satisfied by *net.Dialer and by proxy dialers.
+type contextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// newDialer returns forward itself, or a dialer tunnelling through proxy when one is set.
+func newDialer(forward *net.Dialer, proxy *Proxy, ipMode IPMode) contextDialer {
+	if proxy == nil {
+		return forward
+	}
+
+	return &proxyDialer{proxy: *proxy, forward: forward, ipMode: ipMode}
+}
+
+type proxyDialer struct {
+	proxy   Proxy
+	forward *net.Dialer
+	ipMode  IPMode
+}
+
+// DialContext connects to the proxy and asks it for a tunnel to address.
+func (d *proxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("%s proxy does not support %s", d.proxy.Type, network)
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	conn, err := d.forward.DialContext(ctx, d.ipMode.Network(false), d.proxy.Address)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", d.proxy.Address, err)
+	}
+
+	// Bound the handshake by the context, and abort it if the context is canceled.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+
+	tunnel, err := d.handshake(ctx, conn, host, port)
+	if !stop() {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", d.proxy.Address, err)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+func (d *proxyDialer) handshake(ctx context.Context, conn net.Conn, host string, port int) (net.Conn, error) {
+	switch d.proxy.Type {
+	case ProxySOCKS4, ProxySOCKS4A:
+		return conn, d.socks4(ctx, conn, host, port)
+	case ProxySOCKS5:
+		return conn, d.socks5(conn, host, port)
+	default:
+		return d.httpConnect(conn, host, port)
+	}
+}
+
+// socks4 sends a SOCKS4 CONNECT request, using the SOCKS4a hostname extension when needed.
+func (d *proxyDialer) socks4(ctx context.Context, conn net.Conn, host string, port int) error {
+	req := []byte{4, 1, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], uint16(port))
+
+	var hostname string
+	ip := net.ParseIP(host).To4()
+	switch {
+	case ip != nil:
+	case d.proxy.Type == ProxySOCKS4A:
+		// 0.0.0.x tells the proxy that a hostname follows the user id.
+		ip = net.IPv4(0, 0, 0, 1).To4()
+		hostname = host
+	default:
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+		if err != nil {
+			return err
+		}
+		ip = ips[0].To4()
+	}
+
+	req = append(req, ip...)
+	req = append(req, d.proxy.Username...)
+	req = append(req, 0)
+	if hostname != "" {
+		req = append(req, hostname...)
+		req = append(req, 0)
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 8)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[1] != 90 {
+		return fmt.Errorf("socks4 request rejected (code %d)", resp[1])
+	}
+
+	return nil
+}
+
+var socks5Errors = map[byte]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5 negotiates authentication and sends a SOCKS5 CONNECT request.
+func (d *proxyDialer) socks5(conn net.Conn, host string, port int) error {
+	methods := []byte{0}
+	if d.proxy.Username != "" {
+		methods = append(methods, 2)
+	}
+
+	greeting := append([]byte{5, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	choice := make([]byte, 2)
+	if _, err := io.ReadFull(conn, choice); err != nil {
+		return err
+	}
+	if choice[0] != 5 {
+		return fmt.Errorf("unexpected socks version %d", choice[0])
+	}
+
+	switch choice[1] {
+	case 0:
+	case 2:
+		if err := d.socks5Auth(conn); err != nil {
+			return err
+		}
+	default:
+		return errors.New("socks5 proxy offered no acceptable authentication method")
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, 1)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, 4)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("hostname too long for socks5")
+		}
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		if msg, ok := socks5Errors[head[1]]; ok {
+			return fmt.Errorf("socks5: %s", msg)
+		}
+		return fmt.Errorf("socks5 request failed (code %d)", head[1])
+	}
+
+	// Skip the bound address and port that follow the reply header.
+	var skip int
+	switch head[3] {
+	case 1:
+		skip = net.IPv4len + 2
+	case 4:
+		skip = net.IPv6len + 2
+	case 3:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		skip = int(l[0]) + 2
+	default:
+		return fmt.Errorf("socks5: unknown address type %d", head[3])
+	}
+	_, err := io.CopyN(io.Discard, conn, int64(skip))
+	return err
+}
+
+// socks5Auth performs RFC 1929 username/password authentication.
+func (d *proxyDialer) socks5Auth(conn net.Conn) error {
+	user, pass := d.proxy.Username, d.proxy.Password
+	if len(user) > 255 || len(pass) > 255 {
+		return errors.New("socks5 credentials too long")
+	}
+
+	req := []byte{1, byte(len(user))}
+	req = append(req, user...)
+	req = append(req, byte(len(pass)))
+	req = append(req, pass...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[1] != 0 {
+		return errors.New("socks5 authentication failed")
+	}
+
+	return nil
+}
+
+// httpConnect opens a tunnel with the HTTP CONNECT method.
+func (d *proxyDialer) httpConnect(conn net.Conn, host string, port int) (net.Conn, error) {
+	target := net.JoinHostPort(host, strconv.Itoa(port))
+
+	var req strings.Builder
+	fmt.Fprintf(&req, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
+	if d.proxy.Username != "" {
+		cred := base64.StdEncoding.EncodeToString([]byte(d.proxy.Username + ":" + d.proxy.Password))
+		fmt.Fprintf(&req, "Proxy-Authorization: Basic %s\r\n", cred)
+	}
+	req.WriteString("\r\n")
+
+	if _, err := io.WriteString(conn, req.String()); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http proxy: %s", resp.Status)
+	}
+
+	// Data sent by the target right after the response may already sit in br.
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+// bufferedConn drains a bufio.Reader before reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// NetConn returns the wrapped connection.
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeProxy accepts one connection and runs serve on it.
+func fakeProxy(t *testing.T, serve func(conn net.Conn) error) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if err := serve(conn); err != nil {
+			t.Errorf("proxy: %v", err)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func dialThrough(t *testing.T, proxy Proxy, target string) net.Conn {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := newDialer(&net.Dialer{}, &proxy, IPAny).DialContext(ctx, "tcp", target)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestSOCKS5WithAuth(t *testing.T) {
+	addr := fakeProxy(t, func(conn net.Conn) error {
+		greeting := make([]byte, 4)
+		if _, err := io.ReadFull(conn, greeting); err != nil {
+			return err
+		}
+		if !bytes.Equal(greeting, []byte{5, 2, 0, 2}) {
+			t.Errorf("greeting = %v", greeting)
+		}
+		conn.Write([]byte{5, 2})
+
+		auth := make([]byte, 1+1+4+1+6)
+		if _, err := io.ReadFull(conn, auth); err != nil {
+			return err
+		}
+		if !bytes.Equal(auth, []byte("\x01\x04user\x06secret")) {
+			t.Errorf("auth = %q", auth)
+		}
+		conn.Write([]byte{1, 0})
+
+		req := make([]byte, 5+len("example.com")+2)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return err
+		}
+		if !bytes.Equal(req, []byte("\x05\x01\x00\x03\x0bexample.com\x00\x50")) {
+			t.Errorf("request = %q", req)
+		}
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 80})
+		_, err := conn.Write([]byte("hello"))
+		return err
+	})
+
+	conn := dialThrough(t, Proxy{Address: addr, Type: ProxySOCKS5, Username: "user", Password: "secret"}, "example.com:80")
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+}
+
+func TestSOCKS4ARequest(t *testing.T) {
+	addr := fakeProxy(t, func(conn net.Conn) error {
+		want := []byte("\x04\x01\x00\x16\x00\x00\x00\x01bob\x00example.com\x00")
+		req := make([]byte, len(want))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return err
+		}
+		if !bytes.Equal(req, want) {
+			t.Errorf("request = %q", req)
+		}
+		_, err := conn.Write([]byte{0, 90, 0, 0, 0, 0, 0, 0})
+		return err
+	})
+
+	dialThrough(t, Proxy{Address: addr, Type: ProxySOCKS4A, Username: "bob"}, "example.com:22")
+}
+
+func TestHTTPConnectKeepsBufferedData(t *testing.T) {
+	addr := fakeProxy(t, func(conn net.Conn) error {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return err
+		}
+		if req.Method != http.MethodConnect || req.Host != "example.com:443" {
+			t.Errorf("request = %s %s", req.Method, req.Host)
+		}
+		if got := req.Header.Get("Proxy-Authorization"); got != "Basic dXNlcjpwYXNz" {
+			t.Errorf("Proxy-Authorization = %q", got)
+		}
+		_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nbanner"))
+		return err
+	})
+
+	conn := dialThrough(t, Proxy{Address: addr, Type: ProxyHTTP, Username: "user", Password: "pass"}, "example.com:443")
+
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "banner" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// tokenBucket paces a byte stream to rate bytes per second, allowing bursts of
+// up to burst bytes after a quiet period.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	// A tenth of a second worth of data keeps the stream smooth without
+	// turning every write into a syscall for a single byte.
+	burst := min(max(rate/10, 1), 32*1024)
+
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// chunk is the largest write that can pass without borrowing from the future.
+func (b *tokenBucket) chunk() int {
+	return int(b.burst)
+}
+
+// take removes n tokens and sleeps until the bucket is no longer in debt.
+// Datagrams larger than the burst are never split; they just wait longer.
+func (b *tokenBucket) take(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// limitConn applies separate send (up) and receive (down) limits to a connection.
+// A nil bucket leaves that direction unlimited.
+type limitConn struct {
+	net.Conn
+	up, down *tokenBucket
+	stream   bool
+}
+
+func newLimitConn(conn net.Conn, up, down int64) *limitConn {
+	c := &limitConn{Conn: conn, stream: isStream(conn)}
+	if up > 0 {
+		c.up = newTokenBucket(up)
+	}
+	if down > 0 {
+		c.down = newTokenBucket(down)
+	}
+	return c
+}
+
+// isStream reports whether conn is a byte stream, which may be read and
+// written in small pieces without changing what the peer sees.
+func isStream(conn net.Conn) bool {
+	if addr := conn.LocalAddr(); addr != nil {
+		switch addr.Network() {
+		case "tcp", "tcp4", "tcp6", "unix":
+			return true
+		}
+	}
+	return false
+}
+
+func (c *limitConn) Read(p []byte) (int, error) {
+	if c.down == nil {
+		return c.Conn.Read(p)
+	}
+
+	// Reading in small pieces leaves the rest in the socket buffer, so TCP
+	// flow control slows the sender down instead of us buffering it.
+	if c.stream && len(p) > c.down.chunk() {
+		p = p[:c.down.chunk()]
+	}
+	n, err := c.Conn.Read(p)
+	c.down.take(n)
+	return n, err
+}
+
+func (c *limitConn) Write(p []byte) (int, error) {
+	if c.up == nil {
+		return c.Conn.Write(p)
+	}
+
+	if !c.stream {
+		c.up.take(len(p))
+		return c.Conn.Write(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), c.up.chunk())]
+		c.up.take(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// NetConn returns the wrapped connection.
+func (c *limitConn) NetConn() net.Conn {
+	return c.Conn
+}
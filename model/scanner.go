@@ -5,27 +5,68 @@ package model
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
-// Scan performs a netcat-style "-z" port scan against the given host and port list.
-// Ports are attempted with a worker pool (jobs controls concurrency, default 3); open
-// ports are printed, and closed ports are only reported when verbose mode is on. If
-// idleSeconds is greater than zero, the scan is bounded by that timeout. The optional
-// localPort argument sets a local source port when provided (mirrors nc -p behavior).
-func Scan(host string, ports []int, verbose bool, udp bool, idleSeconds int, localPort int, jobs int, ipMode IPMode) error {
+// Scan performs a netcat-style "-z" port scan of every port on every host.
+// Host×port probes are attempted with a worker pool (jobs controls concurrency,
+// default 3); open ports are printed, and closed ports are only reported when
+// verbose mode is on. Results are grouped by host in the order the hosts were
+// given. If idleSeconds is greater than zero, the scan is bounded by that timeout.
+// The optional localPort argument sets a local source port when provided (mirrors
+// nc -p behavior). TCP probes are tunnelled through opts.Proxy when one is set,
+// and opts.Interval waits between starting consecutive probes. opts.Format and
+// opts.Output select a structured report written once the scan is done, and
+// opts.Services names the service behind each open port. UDP ports are sent
+// the payloads their services answer to, plus opts.UDPPayloads.
+func Scan(hosts []string, ports []int, verbose bool, udp bool, idleSeconds int, localPort int, jobs int, ipMode IPMode, opts ScanOptions) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("no hosts to scan")
+	}
 	if len(ports) == 0 {
 		return fmt.Errorf("no ports to scan")
 	}
 	if jobs < 1 {
 		return fmt.Errorf("jobs must be at least 1")
 	}
-	if err := ipMode.ValidateHost(host, false); err != nil {
-		return err
+	for _, host := range hosts {
+		if err := ipMode.ValidateHost(host, false); err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+	}
+	if udp && opts.Proxy != nil {
+		return fmt.Errorf("proxy cannot be used for UDP scans")
+	}
+	if !udp && len(opts.UDPPayloads) > 0 {
+		return fmt.Errorf("UDP payloads require a UDP scan")
+	}
+	if opts.BannerProbe != "" {
+		probe, err := decodeEscapes(opts.BannerProbe)
+		if err != nil {
+			return fmt.Errorf("invalid banner probe: %w", err)
+		}
+		opts.probe = probe
+	}
+	if udp {
+		// The payloads are needed even when the services are not reported.
+		db := opts.Services
+		if db == nil {
+			var err error
+			if db, err = NewServiceDB(); err != nil {
+				return err
+			}
+		}
+		if err := db.addUDPPayloads(opts.UDPPayloads); err != nil {
+			return err
+		}
+		opts.udpProbes = db
 	}
 
 	ctx := context.Background()
@@ -35,78 +76,137 @@ func Scan(host string, ports []int, verbose bool, udp bool, idleSeconds int, loc
 		defer cancel()
 	}
 
-	dialer := net.Dialer{}
+	forward := &net.Dialer{}
 	if localPort > 0 {
 		if udp {
-			dialer.LocalAddr = &net.UDPAddr{Port: localPort}
+			forward.LocalAddr = &net.UDPAddr{Port: localPort}
 		} else {
-			dialer.LocalAddr = &net.TCPAddr{Port: localPort}
+			forward.LocalAddr = &net.TCPAddr{Port: localPort}
 		}
 	}
+	dialer := newDialer(forward, opts.Proxy, ipMode)
 
-	sem := make(chan struct{}, jobs)
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(ports))
+	report := opts.newReport(verbose, hosts, len(ports))
+	results := make(chan scanResult)
 
-	for _, port := range ports {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+	go func() {
+		var wg sync.WaitGroup
+		defer close(results)
+		defer wg.Wait()
+
+		sem := make(chan struct{}, jobs)
+		for i := range len(hosts) * len(ports) {
+			host, port := hosts[i/len(ports)], ports[i%len(ports)]
 
-		sem <- struct{}{}
-		wg.Add(1)
-		go func(p int) {
-			defer wg.Done()
-			defer func() { <-sem }()
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
 
-			if err := scanPort(ctx, &dialer, host, p, verbose, udp, idleSeconds, ipMode); err != nil {
-				if ctx.Err() != nil {
+			// -i spaces out the probes regardless of how many workers are free.
+			if opts.Interval > 0 && i > 0 {
+				select {
+				case <-ctx.Done():
 					return
+				case <-time.After(opts.Interval):
 				}
-				errCh <- fmt.Errorf("scan error on %s:%d: %w", host, p, err)
 			}
-		}(port)
-	}
 
-	go func() {
-		wg.Wait()
-		close(errCh)
-	}()
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
 
-	for err := range errCh {
-		if verbose {
-			fmt.Println(err.Error())
+				res := scanPort(ctx, dialer, host, port, udp, idleSeconds, ipMode, opts)
+				// Probes cut short by the -w deadline say nothing about the port.
+				if res.Err != nil && ctx.Err() != nil {
+					return
+				}
+				results <- res
+			}()
 		}
+	}()
+
+	for res := range results {
+		report.add(res)
+	}
+
+	if err := report.finish(); err != nil {
+		return err
 	}
 
 	return ctx.Err()
 }
 
-func scanPort(ctx context.Context, dialer *net.Dialer, host string, port int, verbose bool, udp bool, idleSeconds int, ipMode IPMode) error {
+// newReport prints live text lines unless a structured format is going to stdout.
+func (opts ScanOptions) newReport(verbose bool, hosts []string, portsPerHost int) *scanReport {
+	out, progress := opts.Output, os.Stdout
+	switch {
+	case out == nil && opts.Format == ScanText:
+		// The live lines are the report.
+	case out == nil:
+		out, progress = os.Stdout, nil
+	}
+
+	return newScanReport(opts.Format, out, progress, verbose, hosts, portsPerHost)
+}
+
+func scanPort(ctx context.Context, dialer contextDialer, host string, port int, udp bool, idleSeconds int, ipMode IPMode, opts ScanOptions) scanResult {
 	network := ipMode.Network(udp)
 
 	address := net.JoinHostPort(host, strconv.Itoa(port))
 
+	res := scanResult{Host: host, Port: port, Protocol: "tcp", Time: time.Now()}
+
 	if udp {
-		return scanUDP(ctx, dialer, address, host, port, verbose, idleSeconds, network)
+		res.Protocol = "udp"
+		scanUDP(ctx, dialer, address, network, port, idleSeconds, opts, &res)
+		res.Latency = time.Since(res.Time)
+		return res
 	}
 
 	conn, err := dialer.DialContext(ctx, network, address)
+	res.Latency = time.Since(res.Time)
 	if err != nil {
-		if verbose {
-			fmt.Printf("%s:%d closed (%v)\n", host, port, err)
-		}
-		return nil
+		res.Err = err
+		res.State, res.Reason = classifyProbeError(err)
+		return res
 	}
 	defer conn.Close()
 
-	fmt.Printf("%s:%d open\n", host, port)
-	return nil
+	res.State, res.Reason = stateOpen, "syn-ack"
+	// Through a proxy the remote address is the proxy's, not the target's.
+	if _, proxied := dialer.(*proxyDialer); !proxied {
+		if ip := extractIP(conn.RemoteAddr()); ip != nil {
+			res.Address = ip.String()
+		}
+	}
+
+	// greeting is what the port sent unprompted, once the banner grab has read it.
+	var greeting []byte
+	idle := conn
+	if opts.Banner {
+		idle = nil
+		// A service that resets or says nothing is still open; it just has no banner.
+		if raw, err := grabBanner(ctx, conn, opts.probe); err == nil {
+			res.Banner = sanitizeBanner(raw)
+			if len(opts.probe) == 0 {
+				greeting = raw
+			}
+		}
+	}
+
+	if opts.Services != nil {
+		dial := func() (net.Conn, error) { return dialer.DialContext(ctx, network, address) }
+		res.Service, _ = opts.Services.identifyTCP(ctx, port, greeting, idle, dial)
+	}
+	return res
 }
 
-func scanUDP(ctx context.Context, dialer *net.Dialer, address, host string, port int, verbose bool, idleSeconds int, network string) error {
+// scanUDP sends every payload meant for the port and waits for one reply.
+func scanUDP(ctx context.Context, dialer contextDialer, address, network string, port, idleSeconds int, opts ScanOptions, res *scanResult) {
 	timeout := 1 * time.Second
 	if idleSeconds > 0 {
 		timeout = time.Duration(idleSeconds) * time.Second
@@ -114,35 +214,68 @@ func scanUDP(ctx context.Context, dialer *net.Dialer, address, host string, port
 
 	conn, err := dialer.DialContext(ctx, network, address)
 	if err != nil {
-		if verbose {
-			fmt.Printf("%s:%d closed (%v)\n", host, port, err)
-		}
-		return nil
+		res.Err = err
+		res.State, res.Reason = classifyProbeError(err)
+		return
 	}
 	defer conn.Close()
 
+	if ip := extractIP(conn.RemoteAddr()); ip != nil {
+		res.Address = ip.String()
+	}
+
 	_ = conn.SetDeadline(time.Now().Add(timeout))
 
-	if _, err := conn.Write([]byte{0}); err != nil {
-		if verbose {
-			fmt.Printf("%s:%d closed (%v)\n", host, port, err)
+	probes := opts.udpProbes.udpProbesFor(port)
+	for _, p := range probes {
+		if _, err := conn.Write(p.payload); err != nil {
+			res.Err = err
+			res.State, res.Reason = classifyProbeError(err)
+			return
 		}
-		return nil
 	}
 
-	buf := make([]byte, 1)
-	if _, err := conn.Read(buf); err != nil {
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err != nil {
 		if netError, ok := err.(net.Error); ok && netError.Timeout() {
 			// UDP targets often stay silent; treat as open|filtered when no ICMP response arrives.
-			fmt.Printf("%s:%d open|filtered\n", host, port)
-			return nil
-		}
-		if verbose {
-			fmt.Printf("%s:%d closed (%v)\n", host, port, err)
+			res.State, res.Reason = stateOpenFiltered, "no-response"
+			return
 		}
-		return nil
+		res.Err = err
+		res.State, res.Reason = classifyProbeError(err)
+		return
 	}
 
-	fmt.Printf("%s:%d open\n", host, port)
-	return nil
+	info, valid := opts.udpProbes.udpReply(probes, buf[:n])
+	if !valid {
+		// Something answered, but not the way the probed service would.
+		res.State, res.Reason = stateOpenFiltered, "unexpected-response"
+		res.Banner = sanitizeBanner(buf[:n])
+		return
+	}
+
+	res.State, res.Reason = stateOpen, "udp-response"
+	if opts.Services != nil {
+		res.Service = info
+	}
+}
+
+// classifyProbeError maps a failed probe to a port state and an nmap-style reason.
+func classifyProbeError(err error) (string, string) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		// For UDP this is the ICMP port unreachable reply.
+		return stateClosed, "conn-refused"
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return stateFiltered, "host-unreach"
+	case errors.Is(err, syscall.ENETUNREACH):
+		return stateFiltered, "net-unreach"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return stateFiltered, "no-response"
+	default:
+		return stateClosed, "error"
+	}
 }
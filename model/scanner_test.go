@@ -0,0 +1,118 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScanInterval(t *testing.T) {
+	const interval = 100 * time.Millisecond
+
+	// Each port records when it was probed.
+	var mu sync.Mutex
+	var probed []time.Time
+	var ports []int
+	for range 3 {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				probed = append(probed, time.Now())
+				mu.Unlock()
+				conn.Close()
+			}
+		}()
+		ports = append(ports, ln.Addr().(*net.TCPAddr).Port)
+	}
+
+	output := fakeStdio(t, "")
+	var report bytes.Buffer
+	// Enough workers for every port, so only -i keeps the probes apart.
+	opts := ScanOptions{Interval: interval, Format: ScanJSON, Output: &report}
+	if err := Scan([]string{"127.0.0.1"}, ports, false, false, 0, 0, len(ports), IPv4Only, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(output(), " open"); got != len(ports) {
+		t.Errorf("%d ports reported open, want %d", got, len(ports))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(probed) != len(ports) {
+		t.Fatalf("%d ports probed, want %d", len(probed), len(ports))
+	}
+	sort.Slice(probed, func(i, j int) bool { return probed[i].Before(probed[j]) })
+	for i := 1; i < len(probed); i++ {
+		// Accept runs slightly after the connection is made; allow for that.
+		if gap := probed[i].Sub(probed[i-1]); gap < interval-20*time.Millisecond {
+			t.Errorf("probe %d came %v after the previous one, want about %v", i, gap, interval)
+		}
+	}
+}
+
+func TestScanUDPReplyMustMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		reply      string
+		wantState  string
+		wantBanner string
+	}{
+		{name: "matching reply", reply: "pong 1.2", wantState: stateOpen},
+		{name: "other reply", reply: "ERR\r\n", wantState: stateOpenFiltered, wantBanner: "ERR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pc.Close()
+			port := pc.LocalAddr().(*net.UDPAddr).Port
+			go func() {
+				buf := make([]byte, 64)
+				n, from, err := pc.ReadFrom(buf)
+				if err == nil && string(buf[:n]) == "ping" {
+					_, _ = pc.WriteTo([]byte(tt.reply), from)
+				}
+			}()
+
+			// A probe of its own for the port, with a pattern for its answer.
+			probes := filepath.Join(t.TempDir(), "ping.probes")
+			spec := fmt.Sprintf("Probe UDP Ping q|ping|\nports %d\nmatch ping m|^pong ([\\d.]+)| v/$1/\n", port)
+			if err := os.WriteFile(probes, []byte(spec), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			db, err := NewServiceDB(probes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts := ScanOptions{Services: db, udpProbes: db}
+			res := scanPort(context.Background(), &net.Dialer{}, "127.0.0.1", port, true, 1, IPv4Only, opts)
+			if res.State != tt.wantState || res.Banner != tt.wantBanner {
+				t.Errorf("state %q banner %q, want %q and %q", res.State, res.Banner, tt.wantState, tt.wantBanner)
+			}
+			if tt.wantState == stateOpen && res.Service.String() != "ping 1.2" {
+				t.Errorf("service %q", res.Service.String())
+			}
+		})
+	}
+}
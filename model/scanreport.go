@@ -0,0 +1,537 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScanFormat selects how port scan results are written.
+type ScanFormat int
+
+const (
+	// ScanText prints "host:port state" lines as results come in.
+	ScanText ScanFormat = iota
+	// ScanJSON writes one JSON document with the ports grouped by host.
+	ScanJSON
+	// ScanCSV writes one row per scanned port.
+	ScanCSV
+	// ScanGrepable writes one nmap -oG style line per host.
+	ScanGrepable
+	// ScanXML writes an nmap -oX style document.
+	ScanXML
+)
+
+// String returns the name used for the format on the command line.
+func (f ScanFormat) String() string {
+	switch f {
+	case ScanJSON:
+		return "json"
+	case ScanCSV:
+		return "csv"
+	case ScanGrepable:
+		return "grepable"
+	case ScanXML:
+		return "xml"
+	default:
+		return "text"
+	}
+}
+
+// Port states, named as nmap reports them.
+const (
+	stateOpen         = "open"
+	stateClosed       = "closed"
+	stateFiltered     = "filtered"
+	stateOpenFiltered = "open|filtered"
+)
+
+// scanResult is the outcome of probing one port.
+type scanResult struct {
+	Host     string
+	Address  string
+	Port     int
+	Protocol string
+	State    string
+	Reason   string
+	Err      error
+	Latency  time.Duration
+	Time     time.Time
+	Banner   string
+	Service  serviceInfo
+}
+
+// scanReport prints results as they arrive and writes the structured report at the end.
+type scanReport struct {
+	format   ScanFormat
+	out      io.Writer
+	progress io.Writer
+	verbose  bool
+	hosts    []string
+	start    time.Time
+	results  []scanResult
+
+	// Live lines of one host are printed together: results for hosts after
+	// the current one wait in held until every earlier host is done.
+	current   int
+	remaining map[string]int
+	held      map[string][]scanResult
+}
+
+// newScanReport sends live text lines to progress, or nowhere when progress is nil,
+// and the report in the chosen format to out when the scan finishes.
+func newScanReport(format ScanFormat, out, progress io.Writer, verbose bool, hosts []string, portsPerHost int) *scanReport {
+	r := &scanReport{
+		format:    format,
+		out:       out,
+		progress:  progress,
+		verbose:   verbose,
+		hosts:     hosts,
+		start:     time.Now(),
+		remaining: make(map[string]int),
+		held:      make(map[string][]scanResult),
+	}
+	for _, h := range hosts {
+		r.remaining[h] += portsPerHost
+	}
+	return r
+}
+
+func (r *scanReport) add(res scanResult) {
+	// Plain text scans only print live lines; keeping every result would
+	// grow without bound on large scans.
+	if r.out != nil {
+		r.results = append(r.results, res)
+	}
+	if r.progress == nil {
+		return
+	}
+
+	r.remaining[res.Host]--
+	if r.current < len(r.hosts) && res.Host != r.hosts[r.current] {
+		r.held[res.Host] = append(r.held[res.Host], res)
+		return
+	}
+	r.writeText(r.progress, res)
+
+	for r.current < len(r.hosts) && r.remaining[r.hosts[r.current]] <= 0 {
+		r.current++
+		if r.current < len(r.hosts) {
+			r.flushHeld(r.hosts[r.current])
+		}
+	}
+}
+
+func (r *scanReport) flushHeld(host string) {
+	for _, res := range r.held[host] {
+		r.writeText(r.progress, res)
+	}
+	delete(r.held, host)
+}
+
+// writeText prints the classic netcat line; ports that are not open only show up with -v.
+func (r *scanReport) writeText(w io.Writer, res scanResult) {
+	switch {
+	case res.State == stateOpen || res.State == stateOpenFiltered:
+		line := fmt.Sprintf("%s:%d %s", res.Host, res.Port, res.State)
+		if res.Service.Name != "" {
+			line += " " + res.Service.String()
+		}
+		if res.Banner != "" {
+			line += " | " + res.Banner
+		}
+		fmt.Fprintln(w, line)
+	case r.verbose && res.Err != nil:
+		fmt.Fprintf(w, "%s:%d %s (%v)\n", res.Host, res.Port, res.State, res.Err)
+	case r.verbose:
+		fmt.Fprintf(w, "%s:%d %s\n", res.Host, res.Port, res.State)
+	}
+}
+
+// hostResults is the results of one host, sorted by port.
+type hostResults struct {
+	host    string
+	address string
+	ports   []scanResult
+}
+
+// grouped orders the results by host, in the order the hosts were given, then by port.
+func (r *scanReport) grouped() []hostResults {
+	index := make(map[string]int)
+	var groups []hostResults
+	for _, h := range r.hosts {
+		if _, ok := index[h]; !ok {
+			index[h] = len(groups)
+			groups = append(groups, hostResults{host: h})
+		}
+	}
+
+	for _, res := range r.results {
+		i, ok := index[res.Host]
+		if !ok {
+			i = len(groups)
+			index[res.Host] = i
+			groups = append(groups, hostResults{host: res.Host})
+		}
+		g := &groups[i]
+		if g.address == "" {
+			g.address = res.Address
+		}
+		g.ports = append(g.ports, res)
+	}
+
+	for i := range groups {
+		if groups[i].address == "" && net.ParseIP(groups[i].host) != nil {
+			groups[i].address = groups[i].host
+		}
+		slices.SortFunc(groups[i].ports, func(a, b scanResult) int {
+			return cmp.Or(cmp.Compare(a.Port, b.Port), strings.Compare(a.Protocol, b.Protocol))
+		})
+	}
+
+	return groups
+}
+
+// finish prints live lines still held back, for hosts whose probes were cut
+// short by the deadline, and writes the report to out.
+func (r *scanReport) finish() error {
+	if r.progress != nil {
+		for ; r.current < len(r.hosts); r.current++ {
+			r.flushHeld(r.hosts[r.current])
+		}
+	}
+
+	if r.out == nil {
+		return nil
+	}
+
+	switch r.format {
+	case ScanJSON:
+		return r.writeJSON()
+	case ScanCSV:
+		return r.writeCSV()
+	case ScanGrepable:
+		return r.writeGrepable()
+	case ScanXML:
+		return r.writeXML()
+	default:
+		for _, g := range r.grouped() {
+			for _, res := range g.ports {
+				r.writeText(r.out, res)
+			}
+		}
+		return nil
+	}
+}
+
+func latencyMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+type jsonPort struct {
+	Port      int     `json:"port"`
+	Protocol  string  `json:"protocol"`
+	State     string  `json:"state"`
+	Reason    string  `json:"reason"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Timestamp string  `json:"timestamp"`
+	Banner    string  `json:"banner,omitempty"`
+	Service   string  `json:"service,omitempty"`
+	Product   string  `json:"product,omitempty"`
+	Version   string  `json:"version,omitempty"`
+	Info      string  `json:"info,omitempty"`
+}
+
+type jsonHost struct {
+	Host    string     `json:"host"`
+	Address string     `json:"address,omitempty"`
+	Ports   []jsonPort `json:"ports"`
+}
+
+type jsonScan struct {
+	Scanner  string     `json:"scanner"`
+	Started  string     `json:"started"`
+	Finished string     `json:"finished"`
+	Elapsed  float64    `json:"elapsed_seconds"`
+	Hosts    []jsonHost `json:"hosts"`
+}
+
+func (r *scanReport) writeJSON() error {
+	now := time.Now()
+	doc := jsonScan{
+		Scanner:  "nc",
+		Started:  r.start.UTC().Format(time.RFC3339Nano),
+		Finished: now.UTC().Format(time.RFC3339Nano),
+		Elapsed:  now.Sub(r.start).Seconds(),
+		Hosts:    []jsonHost{},
+	}
+
+	for _, g := range r.grouped() {
+		host := jsonHost{Host: g.host, Address: g.address, Ports: []jsonPort{}}
+		for _, res := range g.ports {
+			host.Ports = append(host.Ports, jsonPort{
+				Port:      res.Port,
+				Protocol:  res.Protocol,
+				State:     res.State,
+				Reason:    res.Reason,
+				Error:     errString(res.Err),
+				LatencyMS: latencyMillis(res.Latency),
+				Timestamp: res.Time.UTC().Format(time.RFC3339Nano),
+				Banner:    res.Banner,
+				Service:   res.Service.Name,
+				Product:   res.Service.Product,
+				Version:   res.Service.Version,
+				Info:      res.Service.Info,
+			})
+		}
+		doc.Hosts = append(doc.Hosts, host)
+	}
+
+	enc := json.NewEncoder(r.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func (r *scanReport) writeCSV() error {
+	w := csv.NewWriter(r.out)
+	_ = w.Write([]string{"host", "address", "port", "protocol", "state", "reason", "latency_ms", "timestamp", "error", "banner", "service", "product", "version", "info"})
+
+	for _, g := range r.grouped() {
+		for _, res := range g.ports {
+			_ = w.Write([]string{
+				res.Host,
+				g.address,
+				strconv.Itoa(res.Port),
+				res.Protocol,
+				res.State,
+				res.Reason,
+				strconv.FormatFloat(latencyMillis(res.Latency), 'f', 3, 64),
+				res.Time.UTC().Format(time.RFC3339Nano),
+				errString(res.Err),
+				res.Banner,
+				res.Service.Name,
+				res.Service.Product,
+				res.Service.Version,
+				res.Service.Info,
+			})
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+func (r *scanReport) writeGrepable() error {
+	fmt.Fprintf(r.out, "# nc scan initiated %s\n", r.start.Format(time.ANSIC))
+
+	groups := r.grouped()
+	for _, g := range groups {
+		address, name := g.host, ""
+		if g.address != "" && g.address != g.host {
+			address, name = g.address, g.host
+		}
+
+		ports := make([]string, 0, len(g.ports))
+		for _, res := range g.ports {
+			// port/state/protocol/owner/service/rpc info/version/
+			version := strings.ReplaceAll(res.Service.detail(), "/", "|")
+			ports = append(ports, fmt.Sprintf("%d/%s/%s//%s//%s/", res.Port, res.State, res.Protocol, res.Service.Name, version))
+		}
+		fmt.Fprintf(r.out, "Host: %s (%s)\tPorts: %s\n", address, name, strings.Join(ports, ", "))
+	}
+
+	elapsed := time.Since(r.start).Seconds()
+	_, err := fmt.Fprintf(r.out, "# nc done at %s -- %d hosts scanned in %.2f seconds\n",
+		time.Now().Format(time.ANSIC), len(groups), elapsed)
+	return err
+}
+
+type xmlRun struct {
+	XMLName  xml.Name    `xml:"nmaprun"`
+	Scanner  string      `xml:"scanner,attr"`
+	Start    int64       `xml:"start,attr"`
+	StartStr string      `xml:"startstr,attr"`
+	Version  string      `xml:"xmloutputversion,attr"`
+	Hosts    []xmlHost   `xml:"host"`
+	RunStats xmlRunStats `xml:"runstats"`
+}
+
+type xmlHost struct {
+	Status    xmlStatus     `xml:"status"`
+	Addresses []xmlAddress  `xml:"address"`
+	Hostnames *xmlHostnames `xml:"hostnames,omitempty"`
+	Ports     []xmlPort     `xml:"ports>port"`
+}
+
+type xmlStatus struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type xmlAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+}
+
+type xmlHostnames struct {
+	Hostnames []xmlHostname `xml:"hostname"`
+}
+
+type xmlHostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type xmlPort struct {
+	Protocol string      `xml:"protocol,attr"`
+	PortID   int         `xml:"portid,attr"`
+	State    xmlState    `xml:"state"`
+	Service  *xmlService `xml:"service,omitempty"`
+	Scripts  []xmlScript `xml:"script"`
+}
+
+// xmlService follows nmap's service element for a fingerprinted port.
+type xmlService struct {
+	Name      string `xml:"name,attr"`
+	Product   string `xml:"product,attr,omitempty"`
+	Version   string `xml:"version,attr,omitempty"`
+	ExtraInfo string `xml:"extrainfo,attr,omitempty"`
+	Method    string `xml:"method,attr"`
+}
+
+// xmlScript carries the banner the way nmap's banner script reports it.
+type xmlScript struct {
+	ID     string `xml:"id,attr"`
+	Output string `xml:"output,attr"`
+}
+
+// xmlState follows nmap's state element; latency, time and error are additions of ours.
+type xmlState struct {
+	State     string `xml:"state,attr"`
+	Reason    string `xml:"reason,attr"`
+	ReasonTTL int    `xml:"reason_ttl,attr"`
+	Latency   string `xml:"latency_ms,attr"`
+	Time      int64  `xml:"time,attr"`
+	Error     string `xml:"error,attr,omitempty"`
+}
+
+type xmlRunStats struct {
+	Finished xmlFinished `xml:"finished"`
+	Hosts    xmlHostStat `xml:"hosts"`
+}
+
+type xmlFinished struct {
+	Time    int64  `xml:"time,attr"`
+	TimeStr string `xml:"timestr,attr"`
+	Elapsed string `xml:"elapsed,attr"`
+	Exit    string `xml:"exit,attr"`
+}
+
+type xmlHostStat struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+func (r *scanReport) writeXML() error {
+	now := time.Now()
+	doc := xmlRun{
+		Scanner:  "nc",
+		Start:    r.start.Unix(),
+		StartStr: r.start.Format(time.ANSIC),
+		Version:  "1.05",
+		RunStats: xmlRunStats{
+			Finished: xmlFinished{
+				Time:    now.Unix(),
+				TimeStr: now.Format(time.ANSIC),
+				Elapsed: strconv.FormatFloat(now.Sub(r.start).Seconds(), 'f', 2, 64),
+				Exit:    "success",
+			},
+		},
+	}
+
+	for _, g := range r.grouped() {
+		host := xmlHost{Status: xmlStatus{State: "down", Reason: "no-response"}}
+		if ip := net.ParseIP(g.address); ip != nil {
+			addrType := "ipv6"
+			if ip.To4() != nil {
+				addrType = "ipv4"
+			}
+			host.Addresses = append(host.Addresses, xmlAddress{Addr: g.address, AddrType: addrType})
+		}
+		if g.host != g.address {
+			host.Hostnames = &xmlHostnames{Hostnames: []xmlHostname{{Name: g.host, Type: "user"}}}
+		}
+
+		for _, res := range g.ports {
+			if res.State == stateOpen || res.State == stateClosed {
+				host.Status = xmlStatus{State: "up", Reason: res.Reason}
+			}
+			var service *xmlService
+			if res.Service.Name != "" {
+				service = &xmlService{
+					Name:      res.Service.Name,
+					Product:   res.Service.Product,
+					Version:   res.Service.Version,
+					ExtraInfo: res.Service.Info,
+					Method:    "probed",
+				}
+			}
+			var scripts []xmlScript
+			if res.Banner != "" {
+				scripts = append(scripts, xmlScript{ID: "banner", Output: res.Banner})
+			}
+			host.Ports = append(host.Ports, xmlPort{
+				Protocol: res.Protocol,
+				PortID:   res.Port,
+				State: xmlState{
+					State:   res.State,
+					Reason:  res.Reason,
+					Latency: strconv.FormatFloat(latencyMillis(res.Latency), 'f', 3, 64),
+					Time:    res.Time.Unix(),
+					Error:   errString(res.Err),
+				},
+				Service: service,
+				Scripts: scripts,
+			})
+		}
+
+		if host.Status.State == "up" {
+			doc.RunStats.Hosts.Up++
+		} else {
+			doc.RunStats.Hosts.Down++
+		}
+		doc.Hosts = append(doc.Hosts, host)
+	}
+	doc.RunStats.Hosts.Total = len(doc.Hosts)
+
+	if _, err := io.WriteString(r.out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(r.out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(r.out, "\n")
+	return err
+}
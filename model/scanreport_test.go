@@ -0,0 +1,67 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleReport(format ScanFormat, out *bytes.Buffer) *scanReport {
+	r := newScanReport(format, out, nil, false, []string{"example.com", "10.0.0.1"}, 2)
+	now := time.Now()
+	r.add(scanResult{Host: "10.0.0.1", Port: 22, Protocol: "tcp", State: stateOpen, Reason: "syn-ack", Time: now})
+	r.add(scanResult{Host: "example.com", Address: "192.0.2.7", Port: 443, Protocol: "tcp", State: stateOpen, Reason: "syn-ack", Latency: 1500 * time.Microsecond, Time: now, Service: serviceInfo{Name: "http", Product: "nginx", Version: "1.24.0"}})
+	r.add(scanResult{Host: "example.com", Port: 80, Protocol: "tcp", State: stateClosed, Reason: "conn-refused", Err: errors.New("refused"), Time: now})
+	return r
+}
+
+func TestScanReportFormats(t *testing.T) {
+	var out bytes.Buffer
+
+	if err := sampleReport(ScanJSON, &out).finish(); err != nil {
+		t.Fatal(err)
+	}
+	var doc jsonScan
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(doc.Hosts) != 2 || doc.Hosts[0].Host != "example.com" || doc.Hosts[0].Address != "192.0.2.7" {
+		t.Fatalf("hosts not grouped in input order: %+v", doc.Hosts)
+	}
+	if p := doc.Hosts[0].Ports; len(p) != 2 || p[0].Port != 80 || p[0].Error != "refused" || p[1].LatencyMS != 1.5 || p[1].Product != "nginx" {
+		t.Errorf("unexpected ports: %+v", p)
+	}
+
+	out.Reset()
+	if err := sampleReport(ScanCSV, &out).finish(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[3], "10.0.0.1,10.0.0.1,22,tcp,open,syn-ack,") {
+		t.Errorf("unexpected CSV:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := sampleReport(ScanGrepable, &out).finish(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Host: 192.0.2.7 (example.com)\tPorts: 80/closed/tcp/////, 443/open/tcp//http//nginx 1.24.0/\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("grepable output missing %q:\n%s", want, out.String())
+	}
+
+	out.Reset()
+	if err := sampleReport(ScanXML, &out).finish(); err != nil {
+		t.Fatal(err)
+	}
+	var run xmlRun
+	if err := xml.Unmarshal(out.Bytes(), &run); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if run.RunStats.Hosts.Up != 2 || len(run.Hosts[1].Ports) != 1 || run.Hosts[1].Addresses[0].AddrType != "ipv4" || run.Hosts[0].Ports[1].Service.Version != "1.24.0" {
+		t.Errorf("unexpected XML document: %+v", run)
+	}
+}
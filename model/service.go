@@ -0,0 +1,496 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ServiceDB is a registry of probes and response patterns used to identify
+// the service behind an open port, in the spirit of nmap-service-probes.
+//
+// The text format has one directive per line; # starts a comment:
+//
+//	Probe TCP <name> q|<payload>|
+//	ports <port>,<low>-<high>,...
+//	match <service> m|<regex>|[is] [p/<product>/] [v/<version>/] [i/<info>/]
+//
+// The payload accepts \r, \n, \t, \0, \\ and \xNN escapes. Any punctuation
+// character may replace | as the delimiter. Regexes use Go syntax but match
+// responses byte for byte, so \xNN stands for that byte; the i and s flags
+// mean case-insensitive and dot-matches-newline, and $1..$9 in the product,
+// version and info templates are replaced with submatches. A probe with a
+// ports line is only sent to those ports. The TCP NULL probe, with an empty
+// payload, just listens for a greeting; its matches are also tried on the
+// answers to every other TCP probe. A UDP port gets every UDP probe meant for
+// it at once, or the probes without a ports line when none is.
+type ServiceDB struct {
+	probes []*serviceProbe
+}
+
+// builtinServiceProbes is the default probe database, loaded before any file.
+//
+//go:embed service_probes.txt
+var builtinServiceProbes string
+
+type serviceProbe struct {
+	protocol string
+	name     string
+	payload  []byte
+	ports    map[int]bool
+	matches  []serviceMatch
+}
+
+type serviceMatch struct {
+	service string
+	re      *regexp.Regexp
+	product string
+	version string
+	info    string
+}
+
+// serviceInfo is what a match says about a port.
+type serviceInfo struct {
+	Name    string
+	Product string
+	Version string
+	Info    string
+}
+
+// String renders the service the way it is printed after the port state.
+func (s serviceInfo) String() string {
+	return strings.TrimSpace(s.Name + " " + s.detail())
+}
+
+// detail is the product, version and extra info, as in nmap's VERSION column.
+func (s serviceInfo) detail() string {
+	out := strings.TrimSpace(s.Product + " " + s.Version)
+	if s.Info != "" {
+		out = strings.TrimSpace(out + " (" + s.Info + ")")
+	}
+	return out
+}
+
+// NewServiceDB loads the built-in probes followed by the given probe files.
+// Matches from a file are tried before the built-in ones of the same probe.
+func NewServiceDB(files ...string) (*ServiceDB, error) {
+	db := &ServiceDB{}
+	if err := db.parse(strings.NewReader(builtinServiceProbes), "built-in probes", false); err != nil {
+		return nil, err
+	}
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read service probes: %w", err)
+		}
+		err = db.parse(f, path, true)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+func (db *ServiceDB) lookup(protocol, name string) *serviceProbe {
+	for _, p := range db.probes {
+		if p.protocol == protocol && p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// parse reads probe definitions from r. With override set, matches are put in
+// front of those already known for the same probe.
+func (db *ServiceDB) parse(r io.Reader, source string, override bool) error {
+	var probe *serviceProbe
+	var added []serviceMatch
+
+	flush := func() {
+		if probe != nil && len(added) > 0 {
+			if override {
+				probe.matches = append(added, probe.matches...)
+			} else {
+				probe.matches = append(probe.matches, added...)
+			}
+		}
+		added = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fail := func(err error) error {
+			return fmt.Errorf("%s:%d: %w", source, lineNo, err)
+		}
+
+		directive, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+
+		switch directive {
+		case "Probe":
+			flush()
+			p, err := parseProbe(rest)
+			if err != nil {
+				return fail(err)
+			}
+			if existing := db.lookup(p.protocol, p.name); existing != nil {
+				existing.payload = p.payload
+				probe = existing
+			} else {
+				db.probes = append(db.probes, p)
+				probe = p
+			}
+		case "ports":
+			if probe == nil {
+				return fail(fmt.Errorf("ports before any Probe"))
+			}
+			ports, err := parsePortList(rest)
+			if err != nil {
+				return fail(err)
+			}
+			if probe.ports == nil {
+				probe.ports = make(map[int]bool)
+			}
+			for _, p := range ports {
+				probe.ports[p] = true
+			}
+		case "match":
+			if probe == nil {
+				return fail(fmt.Errorf("match before any Probe"))
+			}
+			m, err := parseMatch(rest)
+			if err != nil {
+				return fail(err)
+			}
+			added = append(added, m)
+		default:
+			return fail(fmt.Errorf("unknown directive %q", directive))
+		}
+	}
+	flush()
+
+	return scanner.Err()
+}
+
+func parseProbe(s string) (*serviceProbe, error) {
+	fields := strings.SplitN(s, " ", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("expected: Probe <TCP|UDP> <name> q|<payload>|")
+	}
+
+	protocol := strings.ToLower(fields[0])
+	if protocol != "tcp" && protocol != "udp" {
+		return nil, fmt.Errorf("unknown probe protocol %q", fields[0])
+	}
+
+	raw, rest, err := delimited(strings.TrimSpace(fields[2]), "q")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("unexpected %q after probe payload", rest)
+	}
+	payload, err := decodeEscapes(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serviceProbe{protocol: protocol, name: fields[1], payload: payload}, nil
+}
+
+func parseMatch(s string) (serviceMatch, error) {
+	service, rest, _ := strings.Cut(s, " ")
+	if service == "" {
+		return serviceMatch{}, fmt.Errorf("match is missing a service name")
+	}
+
+	pattern, rest, err := delimited(strings.TrimSpace(rest), "m")
+	if err != nil {
+		return serviceMatch{}, err
+	}
+
+	flags := ""
+	for rest != "" && (rest[0] == 'i' || rest[0] == 's') {
+		flags += rest[:1]
+		rest = rest[1:]
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return serviceMatch{}, err
+	}
+	m := serviceMatch{service: service, re: re}
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		// Field names are letters, with nmap's cpe: as the odd one out.
+		name := "cpe:"
+		if !strings.HasPrefix(rest, name) {
+			end := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsLetter(r) })
+			if end <= 0 {
+				return serviceMatch{}, fmt.Errorf("invalid field %q", rest)
+			}
+			name = rest[:end]
+		}
+
+		var value string
+		value, rest, err = delimited(rest, name)
+		if err != nil {
+			return serviceMatch{}, err
+		}
+		// Drop flags such as cpe's trailing "a".
+		rest = strings.TrimLeftFunc(rest, unicode.IsLetter)
+
+		switch name {
+		case "p":
+			m.product = value
+		case "v":
+			m.version = value
+		case "i":
+			m.info = value
+		}
+	}
+
+	return m, nil
+}
+
+// delimited reads prefix<d>value<d> from s and returns value and what follows.
+func delimited(s, prefix string) (string, string, error) {
+	if !strings.HasPrefix(s, prefix) || len(s) < len(prefix)+1 {
+		return "", "", fmt.Errorf("expected %s<delimiter>...<delimiter> in %q", prefix, s)
+	}
+
+	delim := s[len(prefix)]
+	body := s[len(prefix)+1:]
+	end := strings.IndexByte(body, delim)
+	if end < 0 {
+		return "", "", fmt.Errorf("unterminated %s%c...%c in %q", prefix, delim, delim, s)
+	}
+
+	return body[:end], body[end+1:], nil
+}
+
+func parsePortList(s string) ([]int, error) {
+	var ports []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lowStr, highStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			highStr = lowStr
+		}
+
+		low, err1 := strconv.Atoi(lowStr)
+		high, err2 := strconv.Atoi(highStr)
+		if err1 != nil || err2 != nil || low < 1 || high > 65535 || low > high {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		for p := low; p <= high; p++ {
+			ports = append(ports, p)
+		}
+	}
+
+	return ports, nil
+}
+
+// match returns the first pattern of p, then of the NULL probe, that matches resp.
+func (db *ServiceDB) match(p *serviceProbe, resp []byte) (serviceInfo, bool) {
+	candidates := p.matches
+	if null := db.lookup(p.protocol, "NULL"); null != nil && null != p {
+		candidates = append(append([]serviceMatch(nil), p.matches...), null.matches...)
+	}
+
+	text := latin1(resp)
+	for _, m := range candidates {
+		sub := m.re.FindStringSubmatch(text)
+		if sub == nil {
+			continue
+		}
+		return serviceInfo{
+			Name:    m.service,
+			Product: expandTemplate(m.product, sub),
+			Version: expandTemplate(m.version, sub),
+			Info:    expandTemplate(m.info, sub),
+		}, true
+	}
+
+	return serviceInfo{}, false
+}
+
+// latin1 turns every byte into the rune of the same value, so that patterns
+// see binary responses one byte per character.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+var templateVar = regexp.MustCompile(`\$[1-9]`)
+
+func expandTemplate(tmpl string, sub []string) string {
+	out := templateVar.ReplaceAllStringFunc(tmpl, func(v string) string {
+		n := int(v[1] - '0')
+		if n >= len(sub) {
+			return ""
+		}
+		raw := make([]byte, 0, len(sub[n]))
+		for _, r := range sub[n] {
+			raw = append(raw, byte(r))
+		}
+		return sanitizeBanner(raw)
+	})
+	return strings.Join(strings.Fields(out), " ")
+}
+
+// probesFor lists the probes of protocol to try on port: NULL first, then
+// the probes meant for this port, then the ones meant for any port.
+func (db *ServiceDB) probesFor(protocol string, port int) []*serviceProbe {
+	var null, specific, generic []*serviceProbe
+	for _, p := range db.probes {
+		switch {
+		case p.protocol != protocol:
+		case p.name == "NULL":
+			null = append(null, p)
+		case p.ports == nil:
+			generic = append(generic, p)
+		case p.ports[port]:
+			specific = append(specific, p)
+		}
+	}
+
+	return append(append(null, specific...), generic...)
+}
+
+// identifyTCP works through the TCP probes for port until one answer matches.
+// greeting, when non-nil, is what the service already sent unprompted; conn,
+// when non-nil, is an unused connection the NULL probe may listen on. Every
+// other probe gets a fresh connection from dial.
+func (db *ServiceDB) identifyTCP(ctx context.Context, port int, greeting []byte, conn net.Conn, dial func() (net.Conn, error)) (serviceInfo, bool) {
+	for _, p := range db.probesFor("tcp", port) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var resp []byte
+		switch {
+		case p.name == "NULL" && greeting != nil:
+			resp = greeting
+		case p.name == "NULL" && conn != nil:
+			resp, _ = grabBanner(ctx, conn, nil)
+		default:
+			c, err := dial()
+			if err != nil {
+				continue
+			}
+			resp, _ = grabBanner(ctx, c, p.payload)
+			c.Close()
+		}
+
+		if len(resp) == 0 {
+			continue
+		}
+		if info, ok := db.match(p, resp); ok {
+			return info, true
+		}
+	}
+
+	return serviceInfo{}, false
+}
+
+// udpProbesFor lists the UDP probes to send to port: the ones meant for it,
+// or the ones meant for any port when there are none.
+func (db *ServiceDB) udpProbesFor(port int) []*serviceProbe {
+	var specific, generic []*serviceProbe
+	for _, p := range db.probesFor("udp", port) {
+		if p.ports == nil {
+			generic = append(generic, p)
+		} else {
+			specific = append(specific, p)
+		}
+	}
+
+	if len(specific) > 0 {
+		return specific
+	}
+	return generic
+}
+
+// matchAny returns the first match for resp among the patterns of probes.
+func (db *ServiceDB) matchAny(probes []*serviceProbe, resp []byte) (serviceInfo, bool) {
+	for _, p := range probes {
+		if info, ok := db.match(p, resp); ok {
+			return info, true
+		}
+	}
+
+	return serviceInfo{}, false
+}
+
+// udpReply decides whether resp is a valid answer to probes, the ones sent to
+// a port. A port with probes of its own must answer with something their
+// patterns recognise, unless one of them carries no patterns, as --udp-payload
+// probes do; on other ports any reply shows that something is listening.
+func (db *ServiceDB) udpReply(probes []*serviceProbe, resp []byte) (serviceInfo, bool) {
+	if info, ok := db.matchAny(probes, resp); ok {
+		return info, true
+	}
+
+	for _, p := range probes {
+		if p.ports == nil || len(p.matches) == 0 {
+			return serviceInfo{}, true
+		}
+	}
+	return serviceInfo{}, false
+}
+
+// addUDPPayloads registers --udp-payload values, PORTS:PAYLOAD with the payload
+// in probe escape syntax, ahead of the built-in probes for those ports.
+func (db *ServiceDB) addUDPPayloads(specs []string) error {
+	added := make([]*serviceProbe, 0, len(specs))
+	for i, spec := range specs {
+		portList, raw, ok := strings.Cut(spec, ":")
+		if !ok {
+			return fmt.Errorf("invalid UDP payload %q, expected PORTS:PAYLOAD", spec)
+		}
+
+		ports, err := parsePortList(portList)
+		if err != nil {
+			return fmt.Errorf("invalid UDP payload %q: %w", spec, err)
+		}
+		payload, err := decodeEscapes(raw)
+		if err != nil {
+			return fmt.Errorf("invalid UDP payload %q: %w", spec, err)
+		}
+
+		p := &serviceProbe{protocol: "udp", name: fmt.Sprintf("payload-%d", i+1), payload: payload, ports: make(map[int]bool)}
+		for _, port := range ports {
+			p.ports[port] = true
+		}
+		added = append(added, p)
+	}
+
+	db.probes = append(added, db.probes...)
+	return nil
+}
@@ -0,0 +1,231 @@
+package model
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinServiceProbes(t *testing.T) {
+	db, err := NewServiceDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		probe string
+		resp  string
+		want  string
+	}{
+		{"NULL", "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n", "ssh OpenSSH 9.6p1 (protocol 2.0)"},
+		{"NULL", "SSH-2.0-Go\r\n", "ssh Go (protocol 2.0)"},
+		{"NULL", "220 (vsFTPd 3.0.5)\r\n", "ftp vsftpd 3.0.5"},
+		{"NULL", "220 mx.example.com ESMTP Postfix (Debian)\r\n", "smtp Postfix smtpd (mx.example.com)"},
+		{"NULL", "J\x00\x00\x00\x0a8.0.36\x00\x08\x00\x00\x00", "mysql MySQL 8.0.36"},
+		{"NULL", "R\x00\x00\x00\x0a5.5.5-10.11.6-MariaDB\x00", "mysql MariaDB 10.11.6"},
+		{"GetRequest", "HTTP/1.1 200 OK\r\nDate: now\r\nServer: nginx/1.24.0\r\n\r\n", "http nginx 1.24.0"},
+		{"GetRequest", "HTTP/1.0 404 Not Found\r\n\r\n", "http"},
+		// Answers to other probes fall back to the NULL probe's matches.
+		{"GetRequest", "SSH-2.0-dropbear_2022.83\r\nProtocol mismatch.\n", "ssh Dropbear sshd 2022.83 (protocol 2.0)"},
+		{"RedisInfo", "$210\r\n# Server\r\nredis_version:7.2.4\r\n", "redis Redis key-value store 7.2.4"},
+		{"RedisInfo", "-NOAUTH Authentication required.\r\n", "redis Redis key-value store (authentication required)"},
+		{"PostgreSQLStartup", "R\x00\x00\x00\x17\x00\x00\x00\x0aSCRAM-SHA-256\x00\x00", "postgresql PostgreSQL DB"},
+		{"TLSSessionReq", "\x15\x03\x03\x00\x02\x02\x28", "ssl (TLS alert)"},
+		{"NULL", "H\x00\x00\x00\xffj\x04Host '10.0.0.9' is not allowed to connect to this MySQL server", "mysql MySQL (unauthorized)"},
+		{"MemcachedStats", "STAT pid 1\r\nSTAT uptime 5\r\nSTAT time 1700000000\r\nSTAT version 1.6.21\r\n", "memcached Memcached 1.6.21"},
+	}
+
+	for _, tt := range tests {
+		p := db.lookup("tcp", tt.probe)
+		if p == nil {
+			t.Fatalf("missing built-in probe %s", tt.probe)
+		}
+		info, ok := db.match(p, []byte(tt.resp))
+		if !ok || info.String() != tt.want {
+			t.Errorf("%s %q: got %q (matched %v), want %q", tt.probe, tt.resp, info.String(), ok, tt.want)
+		}
+	}
+
+	if _, ok := db.match(db.lookup("tcp", "GetRequest"), []byte("hello\r\n")); ok {
+		t.Error("unknown answer should not match")
+	}
+}
+
+func TestServiceDBFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "probes")
+	custom := `# local services
+Probe TCP NULL q||
+match ssh m|^SSH-2\.0-OpenSSH_([\w.]+) Ubuntu| p/OpenSSH/ v/$1/ i/Ubuntu Linux/ cpe:/o:canonical:ubuntu_linux/a
+
+Probe TCP Hello q|HELLO\r\n|
+ports 9000-9001,9100
+match greeter m=^hi (\w+)=i p/Greeter/ v/$1/
+`
+	if err := os.WriteFile(path, []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewServiceDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// File matches take precedence over the built-in ones of the same probe.
+	info, _ := db.match(db.lookup("tcp", "NULL"), []byte("SSH-2.0-OpenSSH_9.6p1 Ubuntu-3\r\n"))
+	if want := "ssh OpenSSH 9.6p1 (Ubuntu Linux)"; info.String() != want {
+		t.Errorf("got %q, want %q", info.String(), want)
+	}
+
+	hello := db.lookup("tcp", "Hello")
+	if hello == nil || string(hello.payload) != "HELLO\r\n" {
+		t.Fatalf("Hello probe not loaded: %+v", hello)
+	}
+	if info, _ := db.match(hello, []byte("HI v2\n")); info.String() != "greeter Greeter v2" {
+		t.Errorf("got %q", info.String())
+	}
+
+	var names []string
+	for _, p := range db.probesFor("tcp", 9001) {
+		names = append(names, p.name)
+	}
+	if len(names) < 3 || names[0] != "NULL" || names[1] != "Hello" {
+		t.Errorf("probe order for 9001: %v", names)
+	}
+	for _, p := range db.probesFor("tcp", 22) {
+		if p.name == "Hello" || p.name == "RedisInfo" {
+			t.Errorf("probe %s sent to a port it is not meant for", p.name)
+		}
+	}
+}
+
+func TestServiceDBErrors(t *testing.T) {
+	tests := []string{
+		"match ssh m|^SSH|\n",
+		"Probe SCTP X q||\n",
+		"Probe TCP X q|abc\n",
+		"Probe TCP X q|\\q|\n",
+		"Probe TCP X q||\nports 0\n",
+		"Probe TCP X q||\nmatch x m|(|\n",
+		"Probe TCP X q||\nmatch x m|x| p/unterminated\n",
+		"Probe TCP X q||\nsoftmatch x m|x|\n",
+	}
+
+	for _, src := range tests {
+		path := filepath.Join(t.TempDir(), "probes")
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewServiceDB(path); err == nil {
+			t.Errorf("NewServiceDB accepted %q", src)
+		}
+	}
+}
+
+func TestIdentifyTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// A silent HTTP server: the NULL probe gets nothing, GetRequest identifies it.
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 512)
+				if n, _ := c.Read(buf); n > 3 && string(buf[:3]) == "GET" {
+					c.Write([]byte("HTTP/1.1 200 OK\r\nServer: Apache/2.4.58 (Debian)\r\n\r\n"))
+				}
+			}()
+		}
+	}()
+
+	db, err := NewServiceDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func() (net.Conn, error) { return net.Dial("tcp", ln.Addr().String()) }
+
+	// The greeting was already read as an empty banner, so nothing waits on NULL.
+	info, ok := db.identifyTCP(context.Background(), ln.Addr().(*net.TCPAddr).Port, []byte{}, nil, dial)
+	if want := "http Apache httpd 2.4.58 (Debian)"; !ok || info.String() != want {
+		t.Errorf("got %q (matched %v), want %q", info.String(), ok, want)
+	}
+}
+
+func TestUDPProbes(t *testing.T) {
+	db, err := NewServiceDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.addUDPPayloads([]string{`53,9000-9001:hello\n`, `9001:\x01\x02`}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		port int
+		want []string
+	}{
+		{53, []string{"payload-1", "DNSVersionBindReq"}},
+		{161, []string{"SNMPv1GetRequest"}},
+		{9001, []string{"payload-1", "payload-2"}},
+		{9999, []string{"Zero"}},
+	}
+
+	for _, tt := range tests {
+		var names []string
+		for _, p := range db.udpProbesFor(tt.port) {
+			names = append(names, p.name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("port %d: got probes %v, want %v", tt.port, names, tt.want)
+		}
+	}
+	if got := db.lookup("udp", "payload-2").payload; string(got) != "\x01\x02" {
+		t.Errorf("payload-2 = %q", got)
+	}
+
+	// A version.bind answer: flags 0x8580 only match byte for byte.
+	reply := "\x00\x06\x85\x80\x00\x01\x00\x01\x00\x00\x00\x00\x07version\x04bind\x00\x00\x10\x00\x03" +
+		"\xc0\x0c\x00\x10\x00\x03\x00\x00\x00\x00\x00\x0a\x099.18.24-1"
+	info, ok := db.matchAny(db.udpProbesFor(53), []byte(reply))
+	if want := "dns 9.18.24-1 (version.bind)"; !ok || info.String() != want {
+		t.Errorf("got %q (matched %v), want %q", info.String(), ok, want)
+	}
+	if _, ok := db.matchAny(db.udpProbesFor(53), []byte("\x00\x06\x01\x00")); ok {
+		t.Error("a query echoed back should not match a DNS answer")
+	}
+
+	// Only recognised answers count on ports with probes of their own, unless
+	// a --udp-payload without patterns was sent there too.
+	replies := []struct {
+		port  int
+		reply string
+		valid bool
+	}{
+		{53, "\x00\x06\x01\x00", true},
+		{161, "\x00\x06\x01\x00", false},
+		{161, "\x30\x26\x02\x01\x00\x04\x06public\xa2\x19", true},
+		{9001, "anything", true},
+		{9999, "anything", true},
+	}
+	for _, tt := range replies {
+		if _, valid := db.udpReply(db.udpProbesFor(tt.port), []byte(tt.reply)); valid != tt.valid {
+			t.Errorf("udpReply(%d, %q) = %v, want %v", tt.port, tt.reply, valid, tt.valid)
+		}
+	}
+
+	for _, bad := range []string{"53", "0:x", "53:\\q", "x-y:z"} {
+		if err := db.addUDPPayloads([]string{bad}); err == nil {
+			t.Errorf("addUDPPayloads(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package model
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// reuseAddr leaves the socket untouched where SO_REUSEADDR has different semantics.
+func reuseAddr(_, _ string, _ syscall.RawConn) error {
+	return nil
+}
+
+// connectPeer is not available here; the listener filters peers itself.
+func connectPeer(_ net.PacketConn, _ net.Addr) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,82 @@
+//go:build unix
+
+package model
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// reuseAddr is a socket control hook that sets SO_REUSEADDR, so a fixed
+// source port can be bound again while an earlier connection is in TIME_WAIT.
+func reuseAddr(_, _ string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// connectPeer connects a UDP listening socket to peer, so the kernel drops
+// datagrams from anyone else. Other sockets are left alone.
+func connectPeer(pc net.PacketConn, peer net.Addr) error {
+	conn, ok := pc.(*net.UDPConn)
+	addr, isUDP := peer.(*net.UDPAddr)
+	if !ok || !isUDP {
+		return errors.ErrUnsupported
+	}
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var connErr error
+	err = raw.Control(func(fd uintptr) {
+		local, err := syscall.Getsockname(int(fd))
+		if err != nil {
+			connErr = err
+			return
+		}
+
+		// The peer must be given in the socket's own family; IPv4 peers of
+		// a dual-stack socket are IPv4-mapped IPv6 addresses.
+		var sa syscall.Sockaddr
+		if _, v4 := local.(*syscall.SockaddrInet4); v4 {
+			ip := addr.IP.To4()
+			if ip == nil {
+				connErr = errors.ErrUnsupported
+				return
+			}
+			sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+			copy(sa4.Addr[:], ip)
+			sa = sa4
+		} else {
+			sa6 := &syscall.SockaddrInet6{Port: addr.Port, ZoneId: zoneIndex(addr.Zone)}
+			copy(sa6.Addr[:], addr.IP.To16())
+			sa = sa6
+		}
+		connErr = syscall.Connect(int(fd), sa)
+	})
+	if err != nil {
+		return err
+	}
+	return connErr
+}
+
+// zoneIndex resolves an IPv6 zone, an interface name or index, to its index.
+func zoneIndex(zone string) uint32 {
+	if zone == "" {
+		return 0
+	}
+	if ifi, err := net.InterfaceByName(zone); err == nil {
+		return uint32(ifi.Index)
+	}
+	n, _ := strconv.Atoi(zone)
+	return uint32(n)
+}
@@ -0,0 +1,59 @@
+//go:build unix
+
+package model
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReuseAddrTimeWait(t *testing.T) {
+	servers := make([]net.Listener, 2)
+	for i := range servers {
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				// Wait for the client to close first, so its end lingers in TIME_WAIT.
+				_, _ = conn.Read(make([]byte, 1))
+				conn.Close()
+			}
+		}()
+		servers[i] = ln
+	}
+
+	source := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: freePort(t)}
+	dial := func(server net.Listener, control bool) error {
+		d := net.Dialer{LocalAddr: source, Timeout: 2 * time.Second}
+		if control {
+			d.Control = reuseAddr
+		}
+		conn, err := d.Dial("tcp4", server.Addr().String())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	if err := dial(servers[0], true); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// The source port is still in TIME_WAIT: a plain bind fails, while
+	// SO_REUSEADDR lets -p use it again for a new peer.
+	if err := dial(servers[1], false); err == nil {
+		t.Skip("source port was not held in TIME_WAIT")
+	}
+	if err := dial(servers[1], true); err != nil {
+		t.Errorf("bind with SO_REUSEADDR: %v", err)
+	}
+}
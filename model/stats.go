@@ -0,0 +1,269 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatsMode selects what --stats reports about a connection.
+type StatsMode int
+
+const (
+	// StatsOff reports nothing.
+	StatsOff StatsMode = iota
+	// StatsLive redraws a status line every second and prints a summary on close.
+	StatsLive
+	// StatsJSON prints only the summary, as a single JSON object.
+	StatsJSON
+)
+
+// statsConn counts the bytes moved through a connection and reports them on out.
+type statsConn struct {
+	net.Conn
+	mode     StatsMode
+	out      io.Writer
+	board    *statsBoard
+	start    time.Time
+	sent     atomic.Int64
+	received atomic.Int64
+	once     sync.Once
+
+	// lastSent and lastReceived are the counts at the previous redraw; only
+	// the board touches them, under its lock.
+	lastSent, lastReceived int64
+}
+
+// statsSummary is the --stats-json record written when a connection closes.
+type statsSummary struct {
+	Remote         string  `json:"remote"`
+	Local          string  `json:"local"`
+	BytesSent      int64   `json:"bytes_sent"`
+	BytesReceived  int64   `json:"bytes_received"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	SendRate       float64 `json:"send_bytes_per_second"`
+	ReceiveRate    float64 `json:"receive_bytes_per_second"`
+	StartedAt      string  `json:"started_at"`
+}
+
+func newStatsConn(conn net.Conn, mode StatsMode, out io.Writer) *statsConn {
+	c := &statsConn{
+		Conn:  conn,
+		mode:  mode,
+		out:   out,
+		start: time.Now(),
+	}
+
+	if mode == StatsLive {
+		c.board = boardFor(out)
+		c.board.add(c)
+	}
+
+	return c
+}
+
+// statsBoard owns the live status line of one output. Keep-alive listeners
+// can have several connections at once; they share the line instead of
+// redrawing it over each other, and summaries are printed between redraws.
+type statsBoard struct {
+	out io.Writer
+
+	mu    sync.Mutex
+	conns []*statsConn
+	width int
+	stop  chan struct{}
+}
+
+var (
+	boardsMu sync.Mutex
+	boards   = make(map[io.Writer]*statsBoard)
+)
+
+// boardFor returns the board that draws on out.
+func boardFor(out io.Writer) *statsBoard {
+	boardsMu.Lock()
+	defer boardsMu.Unlock()
+
+	b, ok := boards[out]
+	if !ok {
+		b = &statsBoard{out: out}
+		boards[out] = b
+	}
+	return b
+}
+
+// add starts showing c, and starts redrawing once a second for the first connection.
+func (b *statsBoard) add(c *statsConn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.conns = append(b.conns, c)
+	if b.stop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	b.stop = stop
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.mu.Lock()
+				b.draw()
+				b.mu.Unlock()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// remove stops showing c and prints its summary on a clean line.
+func (b *statsBoard) remove(c *statsConn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, conn := range b.conns {
+		if conn == c {
+			b.conns = append(b.conns[:i], b.conns[i+1:]...)
+			break
+		}
+	}
+	if len(b.conns) == 0 && b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+
+	b.clear()
+	c.writeSummary()
+}
+
+// draw redraws the status line: the connection itself when there is only
+// one, otherwise the totals of all of them. The caller holds b.mu.
+func (b *statsBoard) draw() {
+	if len(b.conns) == 0 {
+		return
+	}
+
+	var sent, received, sentRate, receivedRate int64
+	for _, c := range b.conns {
+		s, r := c.sent.Load(), c.received.Load()
+		sent, received = sent+s, received+r
+		sentRate, receivedRate = sentRate+s-c.lastSent, receivedRate+r-c.lastReceived
+		c.lastSent, c.lastReceived = s, r
+	}
+
+	var line string
+	if len(b.conns) == 1 {
+		c := b.conns[0]
+		line = fmt.Sprintf("%s: sent %s (%s/s), received %s (%s/s), %s",
+			c.peer(), formatBytes(sent), formatBytes(sentRate),
+			formatBytes(received), formatBytes(receivedRate), formatElapsed(time.Since(c.start)))
+	} else {
+		line = fmt.Sprintf("%d connections: sent %s (%s/s), received %s (%s/s)",
+			len(b.conns), formatBytes(sent), formatBytes(sentRate),
+			formatBytes(received), formatBytes(receivedRate))
+	}
+
+	// Pad over the previous line, which may have been longer.
+	fmt.Fprintf(b.out, "\r%-*s", b.width, line)
+	b.width = len(line)
+}
+
+// clear blanks the status line. The caller holds b.mu.
+func (b *statsBoard) clear() {
+	if b.width > 0 {
+		fmt.Fprintf(b.out, "\r%s\r", strings.Repeat(" ", b.width))
+		b.width = 0
+	}
+}
+
+func (c *statsConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.received.Add(int64(n))
+	return n, err
+}
+
+func (c *statsConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.sent.Add(int64(n))
+	return n, err
+}
+
+// Close closes the connection and prints the summary once.
+func (c *statsConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.report)
+	return err
+}
+
+// NetConn returns the wrapped connection.
+func (c *statsConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *statsConn) peer() string {
+	if addr := c.RemoteAddr(); addr != nil && addr.String() != "" {
+		return addr.String()
+	}
+	return c.LocalAddr().String()
+}
+
+func (c *statsConn) report() {
+	if c.board != nil {
+		c.board.remove(c)
+		return
+	}
+	c.writeSummary()
+}
+
+func (c *statsConn) writeSummary() {
+	elapsed := time.Since(c.start)
+	sent, received := c.sent.Load(), c.received.Load()
+	seconds := elapsed.Seconds()
+
+	if c.mode == StatsJSON {
+		summary := statsSummary{
+			Remote:         c.peer(),
+			Local:          c.LocalAddr().String(),
+			BytesSent:      sent,
+			BytesReceived:  received,
+			ElapsedSeconds: seconds,
+			StartedAt:      c.start.UTC().Format(time.RFC3339Nano),
+		}
+		if seconds > 0 {
+			summary.SendRate = float64(sent) / seconds
+			summary.ReceiveRate = float64(received) / seconds
+		}
+		data, _ := json.Marshal(summary)
+		fmt.Fprintf(c.out, "%s\n", data)
+		return
+	}
+
+	fmt.Fprintf(c.out, "%s: sent %s, received %s in %s (avg %s/s up, %s/s down)\n",
+		c.peer(), formatBytes(sent), formatBytes(received), formatElapsed(elapsed),
+		formatBytes(perSecond(sent, seconds)), formatBytes(perSecond(received, seconds)))
+}
+
+func perSecond(n int64, seconds float64) int64 {
+	if seconds <= 0 {
+		return n
+	}
+	return int64(float64(n) / seconds)
+}
+
+// formatElapsed renders d as h:mm:ss.
+func formatElapsed(d time.Duration) string {
+	s := int(d.Seconds())
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestStatsJSONSummary(t *testing.T) {
+	local, remote := net.Pipe()
+	var out bytes.Buffer
+
+	conn := newStatsConn(local, StatsJSON, &out)
+	go func() {
+		_, _ = remote.Write([]byte("hello world"))
+		_, _ = io.ReadFull(remote, make([]byte, 4))
+		_ = remote.Close()
+	}()
+
+	if _, err := io.ReadFull(conn, make([]byte, 11)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	_ = conn.Close()
+
+	var summary statsSummary
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("summary is not a single JSON object: %v\n%s", err, out.String())
+	}
+	if summary.BytesSent != 4 || summary.BytesReceived != 11 {
+		t.Errorf("sent=%d received=%d, want 4 and 11", summary.BytesSent, summary.BytesReceived)
+	}
+}
+
+func TestStatsBoardSharesLine(t *testing.T) {
+	var out bytes.Buffer
+	conns := make([]*statsConn, 2)
+	for i := range conns {
+		local, remote := net.Pipe()
+		defer remote.Close()
+		go func() { _, _ = io.Copy(io.Discard, remote) }()
+		conns[i] = newStatsConn(local, StatsLive, &out)
+		if _, err := conns[i].Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	board := conns[0].board
+	if conns[1].board != board {
+		t.Fatal("connections on the same output should share a board")
+	}
+
+	redraw := func() string {
+		board.mu.Lock()
+		defer board.mu.Unlock()
+		out.Reset()
+		board.draw()
+		return out.String()
+	}
+
+	// Two live connections share one line with their totals.
+	if got := redraw(); !strings.HasPrefix(got, "\r2 connections: sent 10 B") {
+		t.Errorf("shared line %q", got)
+	}
+
+	// A summary clears the line first, and the remaining connection gets it back.
+	out.Reset()
+	_ = conns[0].Close()
+	if got := out.String(); !strings.HasPrefix(got, "\r") || !strings.Contains(got, "\rpipe: sent 5 B, received 0 B") {
+		t.Errorf("summary %q", got)
+	}
+	if got := redraw(); !strings.HasPrefix(got, "\rpipe: sent 5 B (0 B/s)") {
+		t.Errorf("single line %q", got)
+	}
+	_ = conns[1].Close()
+}
@@ -0,0 +1,306 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StdinPolicy decides which keep-alive clients receive the data read from stdin.
+type StdinPolicy int
+
+const (
+	// StdinBroadcast sends every line to all connected clients.
+	StdinBroadcast StdinPolicy = iota
+	// StdinLatest sends stdin only to the most recently connected client.
+	StdinLatest
+	// StdinRoundRobin hands each line to the next client in turn.
+	StdinRoundRobin
+)
+
+// String returns the name used for the policy on the command line.
+func (p StdinPolicy) String() string {
+	switch p {
+	case StdinLatest:
+		return "latest"
+	case StdinRoundRobin:
+		return "round-robin"
+	default:
+		return "broadcast"
+	}
+}
+
+// stdoutMu keeps output lines from concurrent clients from interleaving.
+var stdoutMu sync.Mutex
+
+// stdinBacklog is how many lines of stdin may wait for one client.
+const stdinBacklog = 256
+
+// stdinStall is how long stdin waits for room in a full queue before that
+// client is considered too slow and dropped. Stdin can arrive far faster
+// than any client reads, so a burst alone must not cost a client its session.
+const stdinStall = 2 * time.Second
+
+// stdinMux owns stdin in keep-alive mode and dispatches it to clients by policy.
+// Stdin goes through copyStdin like a single connection's would, so -i paces
+// the lines, and -N and -q apply to every client, including those that connect
+// after stdin has ended. Every client has its own outbound queue, so one that
+// stops reading cannot hold up stdin for the others.
+type stdinMux struct {
+	opts    Options
+	verbose bool
+	in      io.Reader
+	out     io.Writer
+
+	mu      sync.Mutex
+	clients []*stdinClient
+	next    int
+	nextID  int
+	eof     bool
+	ready   *sync.Cond
+	start   sync.Once
+
+	// partial holds the start of a line until its newline arrives; only the
+	// stdin goroutine touches it.
+	partial []byte
+}
+
+// stdinClient is one keep-alive client and the stdin lines queued for it.
+// Only the stdin goroutine sends on out, and it closes out when stdin ends;
+// gone is closed when the client leaves or is dropped.
+type stdinClient struct {
+	conn     net.Conn
+	label    string
+	out      chan []byte
+	gone     chan struct{}
+	goneOnce sync.Once
+}
+
+func (c *stdinClient) leave() {
+	c.goneOnce.Do(func() { close(c.gone) })
+}
+
+func newStdinMux(opts Options, verbose bool) *stdinMux {
+	m := &stdinMux{opts: opts, verbose: verbose, in: os.Stdin, out: os.Stdout}
+	m.ready = sync.NewCond(&m.mu)
+	return m
+}
+
+// serve registers conn as a stdin target and copies its output to stdout,
+// one labelled line at a time, until it closes.
+func (m *stdinMux) serve(conn net.Conn) error {
+	defer conn.Close()
+
+	client := m.add(conn)
+	defer m.remove(client)
+	m.start.Do(func() { go m.readStdin() })
+
+	prefix := "[" + client.label + "] "
+	r := bufio.NewReader(conn)
+	// A line longer than the reader's buffer arrives in several chunks; only
+	// the first one is labelled.
+	lineStart := true
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(chunk) > 0 {
+			stdoutMu.Lock()
+			var werr error
+			if lineStart {
+				_, werr = io.WriteString(m.out, prefix)
+			}
+			if werr == nil {
+				_, werr = m.out.Write(chunk)
+			}
+			stdoutMu.Unlock()
+			if werr != nil {
+				return werr
+			}
+			lineStart = chunk[len(chunk)-1] == '\n'
+		}
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return readErr(err)
+		}
+	}
+}
+
+// add registers conn and starts the goroutine that writes its queue.
+func (m *stdinMux) add(conn net.Conn) *stdinClient {
+	m.mu.Lock()
+	m.nextID++
+	label := conn.RemoteAddr().String()
+	if label == "" || label == "@" {
+		label = "client" + strconv.Itoa(m.nextID)
+	}
+	client := &stdinClient{
+		conn:  conn,
+		label: label,
+		out:   make(chan []byte, stdinBacklog),
+		gone:  make(chan struct{}),
+	}
+	// A client that joins after stdin ended gets no input, only -N and -q.
+	if m.eof {
+		close(client.out)
+	}
+	m.clients = append(m.clients, client)
+	m.ready.Broadcast()
+	m.mu.Unlock()
+
+	go m.send(client)
+	return client
+}
+
+func (m *stdinMux) remove(client *stdinClient) {
+	client.leave()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.clients {
+		if c == client {
+			m.clients = append(m.clients[:i], m.clients[i+1:]...)
+			if m.next > i {
+				m.next--
+			}
+			return
+		}
+	}
+}
+
+// drop disconnects a client that cannot keep up.
+func (m *stdinMux) drop(client *stdinClient, reason string) {
+	if m.verbose {
+		fmt.Fprintf(os.Stderr, "dropping %s, %s\n", client.label, reason)
+	}
+	client.leave()
+	dropConn(client.conn)
+}
+
+// send writes the queued lines of one client. Once stdin has ended and the
+// queue is drained, -N and -q are applied to it.
+func (m *stdinMux) send(client *stdinClient) {
+	for {
+		select {
+		case line, ok := <-client.out:
+			if !ok {
+				m.afterEOF(client.conn)
+				return
+			}
+			if _, err := client.conn.Write(line); err != nil {
+				m.drop(client, err.Error())
+				return
+			}
+		case <-client.gone:
+			return
+		}
+	}
+}
+
+// Write dispatches every complete line in p; copyStdin writes stdin here.
+func (m *stdinMux) Write(p []byte) (int, error) {
+	m.partial = append(m.partial, p...)
+	for {
+		i := bytes.IndexByte(m.partial, '\n')
+		if i < 0 {
+			break
+		}
+		m.dispatch(m.partial[:i+1])
+		m.partial = m.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// targets picks the clients that receive the next line of stdin, waiting
+// until a client is connected so no input is dropped.
+func (m *stdinMux) targets() []*stdinClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for len(m.clients) == 0 {
+		m.ready.Wait()
+	}
+
+	switch m.opts.StdinPolicy {
+	case StdinLatest:
+		return []*stdinClient{m.clients[len(m.clients)-1]}
+	case StdinRoundRobin:
+		if m.next >= len(m.clients) {
+			m.next = 0
+		}
+		target := m.clients[m.next]
+		m.next++
+		return []*stdinClient{target}
+	default:
+		return append([]*stdinClient(nil), m.clients...)
+	}
+}
+
+// dispatch queues line for the clients picked by the policy. A client whose
+// queue stays full for stdinStall is disconnected rather than allowed to
+// stall stdin for everyone else.
+func (m *stdinMux) dispatch(line []byte) {
+	line = append([]byte(nil), line...)
+
+	for _, c := range m.targets() {
+		select {
+		case c.out <- line:
+			continue
+		case <-c.gone:
+			continue
+		default:
+		}
+
+		stall := time.NewTimer(stdinStall)
+		select {
+		case c.out <- line:
+		case <-c.gone:
+		case <-stall.C:
+			m.drop(c, "it is not reading")
+		}
+		stall.Stop()
+	}
+}
+
+// readStdin dispatches stdin until it reaches EOF.
+func (m *stdinMux) readStdin() {
+	if _, err := copyStdin(m, m.in, m.opts); err != nil && m.verbose {
+		fmt.Fprintf(os.Stderr, "stdin read error: %v\n", err)
+	}
+	m.stdinDone()
+}
+
+// stdinDone sends a last unterminated line and ends every queue, so each
+// client gets -N and -q once its remaining lines are written; add takes care
+// of those that connect later.
+func (m *stdinMux) stdinDone() {
+	if len(m.partial) > 0 {
+		m.dispatch(m.partial)
+		m.partial = nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.eof = true
+	for _, c := range m.clients {
+		close(c.out)
+	}
+}
+
+func (m *stdinMux) afterEOF(conn net.Conn) {
+	if quit := m.opts.afterStdinEOF(conn); quit != nil {
+		go func() {
+			<-quit
+			_ = conn.Close()
+		}()
+	}
+}
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// muxClient connects a net.Pipe client to m and collects the lines it receives.
+type muxClient struct {
+	conn  net.Conn
+	mu    sync.Mutex
+	lines []string
+	done  chan struct{}
+}
+
+func addMuxClient(t *testing.T, m *stdinMux) *muxClient {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	c := &muxClient{conn: client, done: make(chan struct{})}
+
+	go func() {
+		defer close(c.done)
+		r := bufio.NewReader(client)
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				c.mu.Lock()
+				c.lines = append(c.lines, line)
+				c.mu.Unlock()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	m.add(server)
+	return c
+}
+
+func (c *muxClient) got() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Join(c.lines, "")
+}
+
+// waitFor waits until the client has received want; lines are written by the
+// client's own goroutine, after Write has returned.
+func (c *muxClient) waitFor(want string) string {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := c.got()
+		if got == want || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStdinMuxPolicies(t *testing.T) {
+	tests := []struct {
+		policy StdinPolicy
+		want   []string
+	}{
+		{StdinBroadcast, []string{"a\nb\nc\nd\n", "a\nb\nc\nd\n"}},
+		{StdinLatest, []string{"", "a\nb\nc\nd\n"}},
+		{StdinRoundRobin, []string{"a\nc\n", "b\nd\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			m := newStdinMux(Options{StdinPolicy: tt.policy}, false)
+			clients := []*muxClient{addMuxClient(t, m), addMuxClient(t, m)}
+
+			// Lines are dispatched whole, however stdin happens to be chunked.
+			for _, chunk := range []string{"a\nb", "\nc\n", "d", "\n"} {
+				if _, err := m.Write([]byte(chunk)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, c := range clients {
+				if got := c.waitFor(tt.want[i]); got != tt.want[i] {
+					t.Errorf("client %d got %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStdinMuxQuitAfterEOF(t *testing.T) {
+	m := newStdinMux(Options{QuitOnEOF: true}, false)
+	early := addMuxClient(t, m)
+
+	if _, err := m.Write([]byte("last line")); err != nil {
+		t.Fatal(err)
+	}
+	m.stdinDone()
+
+	// -q 0 closes clients connected at EOF, and those that connect afterwards.
+	late := addMuxClient(t, m)
+	for name, c := range map[string]*muxClient{"early": early, "late": late} {
+		select {
+		case <-c.done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s client was not closed after stdin EOF", name)
+		}
+	}
+	if got := early.got(); got != "last line" {
+		t.Errorf("unterminated last line: got %q", got)
+	}
+}
+
+func TestStdinMuxLabelsOutput(t *testing.T) {
+	m := newStdinMux(Options{}, false)
+	var out bytes.Buffer
+	m.out = &out
+	m.start.Do(func() {}) // keep the test off the real stdin
+
+	client, server := net.Pipe()
+	done := make(chan error)
+	go func() { done <- m.serve(server) }()
+
+	if _, err := io.WriteString(client, "one\ntwo\n"); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "[pipe] one\n[pipe] two\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestStdinMuxDropsSlowClient(t *testing.T) {
+	m := newStdinMux(Options{}, false)
+
+	// The slow client never reads, so its queue fills up.
+	slow, server := net.Pipe()
+	t.Cleanup(func() { slow.Close() })
+	m.add(server)
+	fast := addMuxClient(t, m)
+
+	var want strings.Builder
+	for i := 0; i < stdinBacklog+10; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		want.WriteString(line)
+		if _, err := m.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := fast.waitFor(want.String()); got != want.String() {
+		t.Errorf("fast client got %d bytes, want %d", len(got), want.Len())
+	}
+
+	// The slow client was disconnected instead of stalling stdin.
+	_ = slow.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.Copy(io.Discard, slow); err != nil {
+		t.Errorf("slow client was not dropped: %v", err)
+	}
+}
+
+func TestStdinMuxLabelsLongLine(t *testing.T) {
+	m := newStdinMux(Options{}, false)
+	var out bytes.Buffer
+	m.out = &out
+	m.start.Do(func() {})
+
+	client, server := net.Pipe()
+	done := make(chan error)
+	go func() { done <- m.serve(server) }()
+
+	// Longer than bufio's default buffer, so it is read in several chunks.
+	long := strings.Repeat("x", 3*4096+100)
+	if _, err := io.WriteString(client, long+"\nshort\n"); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "[pipe] " + long + "\n[pipe] short\n"; out.String() != want {
+		t.Errorf("got %d bytes with %d labels, want one label per line",
+			out.Len(), strings.Count(out.String(), "[pipe]"))
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// maxTargets bounds how many hosts a scan may expand to, so a mistyped IPv6
+// prefix does not try to enumerate the whole address space.
+const maxTargets = 1 << 16
+
+// ipRange is an inclusive range of addresses of one family.
+type ipRange struct {
+	lo, hi netip.Addr
+}
+
+func (r ipRange) contains(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.BitLen() == r.lo.BitLen() && r.lo.Compare(a) <= 0 && a.Compare(r.hi) <= 0
+}
+
+// ExpandTargets turns scan targets into a list of hosts in the order given.
+// A target is a hostname, an IP address, a CIDR block (10.0.0.0/24) or an
+// address range, either 10.0.0.1-50 for the last octet or 10.0.0.1-10.0.1.20.
+// Hosts matching any exclude entry, which takes the same forms, are dropped.
+func ExpandTargets(targets, exclude []string) ([]string, error) {
+	var skipRanges []ipRange
+	skipNames := make(map[string]bool)
+	for _, spec := range exclude {
+		name, r, err := parseTarget(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude %q: %w", spec, err)
+		}
+		if name != "" {
+			skipNames[strings.ToLower(name)] = true
+		} else {
+			skipRanges = append(skipRanges, r)
+		}
+	}
+
+	excluded := func(a netip.Addr) bool {
+		for _, r := range skipRanges {
+			if r.contains(a) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(host string) error {
+		if seen[host] {
+			return nil
+		}
+		if len(hosts) >= maxTargets {
+			return fmt.Errorf("too many hosts, at most %d can be scanned at once", maxTargets)
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+		return nil
+	}
+
+	for _, spec := range targets {
+		name, r, err := parseTarget(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %q: %w", spec, err)
+		}
+
+		if name != "" {
+			if !skipNames[strings.ToLower(name)] {
+				if err := add(name); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		for a, n := r.lo, 1; ; a, n = a.Next(), n+1 {
+			if n > maxTargets {
+				return nil, fmt.Errorf("%s is too large, at most %d hosts can be scanned at once", spec, maxTargets)
+			}
+			if !excluded(a) && !skipNames[a.String()] {
+				if err := add(a.String()); err != nil {
+					return nil, err
+				}
+			}
+			if a == r.hi {
+				break
+			}
+		}
+	}
+
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts left to scan")
+	}
+
+	return hosts, nil
+}
+
+// parseTarget returns either a hostname or the address range a target covers.
+func parseTarget(spec string) (string, ipRange, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return "", ipRange{}, fmt.Errorf("empty host")
+	}
+
+	if strings.Contains(spec, "/") {
+		prefix, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return "", ipRange{}, err
+		}
+		prefix = prefix.Masked()
+		return "", ipRange{lo: prefix.Addr().Unmap(), hi: lastAddr(prefix)}, nil
+	}
+
+	// A zone may contain '-', so only plain addresses are tried as ranges.
+	if ip, err := netip.ParseAddr(spec); err == nil {
+		ip = ip.Unmap()
+		return "", ipRange{lo: ip, hi: ip}, nil
+	}
+
+	if loStr, hiStr, ok := strings.Cut(spec, "-"); ok {
+		if lo, err := netip.ParseAddr(loStr); err == nil {
+			lo = lo.Unmap()
+			hi, err := rangeEnd(lo, hiStr)
+			if err != nil {
+				return "", ipRange{}, err
+			}
+			if hi.Compare(lo) < 0 {
+				return "", ipRange{}, fmt.Errorf("range ends before it starts")
+			}
+			return "", ipRange{lo: lo, hi: hi}, nil
+		}
+	}
+
+	return spec, ipRange{}, nil
+}
+
+// rangeEnd parses the end of a range, which is either a full address of the
+// same family or, for IPv4, just the last octet.
+func rangeEnd(lo netip.Addr, s string) (netip.Addr, error) {
+	if hi, err := netip.ParseAddr(s); err == nil {
+		hi = hi.Unmap()
+		if hi.BitLen() != lo.BitLen() {
+			return netip.Addr{}, fmt.Errorf("range mixes IPv4 and IPv6")
+		}
+		return hi, nil
+	}
+
+	octet, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || !lo.Is4() {
+		return netip.Addr{}, fmt.Errorf("invalid range end %q", s)
+	}
+	b := lo.As4()
+	b[3] = byte(octet)
+	return netip.AddrFrom4(b), nil
+}
+
+// lastAddr returns the highest address inside prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().Unmap().AsSlice()
+	for i := prefix.Bits() - (prefix.Addr().BitLen() - len(b)*8); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandTargets(t *testing.T) {
+	tests := []struct {
+		name      string
+		targets   []string
+		exclude   []string
+		want      []string
+		errSubstr string
+	}{
+		{name: "hostname and ip", targets: []string{"example.com", "10.0.0.1"}, want: []string{"example.com", "10.0.0.1"}},
+		{name: "cidr", targets: []string{"192.168.1.5/30"}, want: []string{"192.168.1.4", "192.168.1.5", "192.168.1.6", "192.168.1.7"}},
+		{name: "last octet range", targets: []string{"10.0.0.1-3"}, want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{name: "full range", targets: []string{"10.0.0.254-10.0.1.1"}, want: []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}},
+		{name: "ipv6 cidr", targets: []string{"2001:db8::/127"}, want: []string{"2001:db8::", "2001:db8::1"}},
+		{name: "duplicates", targets: []string{"10.0.0.1", "10.0.0.0/31"}, want: []string{"10.0.0.1", "10.0.0.0"}},
+		{
+			name:    "exclude",
+			targets: []string{"10.0.0.0/29", "example.com", "other.example"},
+			exclude: []string{"10.0.0.2-4", "10.0.0.6/31", "EXAMPLE.com"},
+			want:    []string{"10.0.0.0", "10.0.0.1", "10.0.0.5", "other.example"},
+		},
+		{name: "reversed range", targets: []string{"10.0.0.9-3"}, errSubstr: "ends before"},
+		{name: "mixed families", targets: []string{"10.0.0.1-::1"}, errSubstr: "mixes"},
+		{name: "too large", targets: []string{"2001:db8::/64"}, errSubstr: "too large"},
+		{name: "all excluded", targets: []string{"10.0.0.1"}, exclude: []string{"10.0.0.0/8"}, errSubstr: "no hosts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandTargets(tt.targets, tt.exclude)
+
+			if tt.errSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errSubstr) {
+					t.Fatalf("error=%v, expected to contain %q", err, tt.errSubstr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
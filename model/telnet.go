@@ -0,0 +1,128 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"bytes"
+	"net"
+	"sync"
+)
+
+// Telnet command bytes (RFC 854).
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+)
+
+// Telnet parser states, kept across reads so sequences may be split between them.
+const (
+	telnetData = iota
+	telnetCommand
+	telnetOption
+	telnetSubneg
+	telnetSubnegIAC
+)
+
+// telnetConn refuses every option the peer negotiates, strips IAC sequences
+// from received data and escapes 0xFF bytes in sent data.
+type telnetConn struct {
+	net.Conn
+	writeMu sync.Mutex
+	state   int
+	verb    byte
+}
+
+func (c *telnetConn) Read(p []byte) (int, error) {
+	for {
+		n, err := c.Conn.Read(p)
+
+		data, replies := c.filter(p[:n])
+		if len(replies) > 0 {
+			if _, werr := c.writeRaw(replies); werr != nil && err == nil {
+				err = werr
+			}
+		}
+
+		// Keep reading when a chunk held nothing but negotiation.
+		if len(data) > 0 || err != nil {
+			return len(data), err
+		}
+	}
+}
+
+func (c *telnetConn) Write(p []byte) (int, error) {
+	escaped := bytes.ReplaceAll(p, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC})
+	if _, err := c.writeRaw(escaped); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *telnetConn) writeRaw(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.Write(p)
+}
+
+// filter removes telnet commands from buf in place, returning the remaining
+// data and the refusals to send back.
+func (c *telnetConn) filter(buf []byte) (data, replies []byte) {
+	data = buf[:0]
+
+	for _, b := range buf {
+		switch c.state {
+		case telnetData:
+			if b == telnetIAC {
+				c.state = telnetCommand
+			} else {
+				data = append(data, b)
+			}
+		case telnetCommand:
+			switch b {
+			case telnetIAC:
+				// Escaped 0xFF data byte
+				data = append(data, b)
+				c.state = telnetData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				c.verb = b
+				c.state = telnetOption
+			case telnetSB:
+				c.state = telnetSubneg
+			default:
+				// Two byte commands such as NOP, GA or AYT carry no option.
+				c.state = telnetData
+			}
+		case telnetOption:
+			switch c.verb {
+			case telnetDO, telnetDONT:
+				replies = append(replies, telnetIAC, telnetWONT, b)
+			case telnetWILL, telnetWONT:
+				replies = append(replies, telnetIAC, telnetDONT, b)
+			}
+			c.state = telnetData
+		case telnetSubneg:
+			if b == telnetIAC {
+				c.state = telnetSubnegIAC
+			}
+		case telnetSubnegIAC:
+			if b == telnetSE {
+				c.state = telnetData
+			} else {
+				c.state = telnetSubneg
+			}
+		}
+	}
+
+	return data, replies
+}
+
+// NetConn returns the wrapped connection.
+func (c *telnetConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTelnetFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		chunks      [][]byte
+		wantData    []byte
+		wantReplies []byte
+	}{
+		{
+			name:     "plain data passes through",
+			chunks:   [][]byte{[]byte("login: ")},
+			wantData: []byte("login: "),
+		},
+		{
+			name: "negotiation is refused",
+			chunks: [][]byte{{
+				telnetIAC, telnetDO, 24, 'a',
+				telnetIAC, telnetWILL, 1, 'b',
+			}},
+			wantData:    []byte("ab"),
+			wantReplies: []byte{telnetIAC, telnetWONT, 24, telnetIAC, telnetDONT, 1},
+		},
+		{
+			name: "sequence split across reads",
+			chunks: [][]byte{
+				{'x', telnetIAC},
+				{telnetWILL},
+				{3, 'y'},
+			},
+			wantData:    []byte("xy"),
+			wantReplies: []byte{telnetIAC, telnetDONT, 3},
+		},
+		{
+			name: "escaped 0xff and subnegotiation",
+			chunks: [][]byte{{
+				telnetIAC, telnetIAC,
+				telnetIAC, telnetSB, 24, 1, telnetIAC, telnetIAC, telnetIAC, telnetSE,
+				telnetIAC, 241, 'z',
+			}},
+			wantData: []byte{0xff, 'z'},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c telnetConn
+			var data, replies []byte
+
+			for _, chunk := range tt.chunks {
+				d, r := c.filter(append([]byte(nil), chunk...))
+				data = append(data, d...)
+				replies = append(replies, r...)
+			}
+
+			if !bytes.Equal(data, tt.wantData) {
+				t.Fatalf("data=%v, want %v", data, tt.wantData)
+			}
+			if !bytes.Equal(replies, tt.wantReplies) {
+				t.Fatalf("replies=%v, want %v", replies, tt.wantReplies)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSOptions configures TLS for connect and listen modes.
+type TLSOptions struct {
+	// ServerName overrides the SNI name sent by the client; it defaults to the target host.
+	ServerName string
+	// ALPN lists the application protocols to offer or accept.
+	ALPN []string
+	// CAFile is a PEM bundle used to verify the peer instead of the system roots.
+	CAFile string
+	// Verify makes the client check the server certificate chain and name.
+	Verify bool
+	// CertFile and KeyFile hold the PEM certificate and key presented to the peer.
+	// A listener without them uses a freshly generated self-signed certificate.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile makes a listener require client certificates issued by this PEM bundle.
+	ClientCAFile string
+	// AllowedPeers restricts verified clients to certificates whose subject, common
+	// name or subject alternative names match one of the entries.
+	AllowedPeers []string
+	// HandshakeTimeout bounds the server handshake of each accepted connection;
+	// zero uses tlsHandshakeTimeout.
+	HandshakeTimeout time.Duration
+}
+
+// tlsHandshakeTimeout is how long a listener waits for a client to complete
+// the handshake when no -w timeout is set.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// clientConfig builds the client side configuration for a connection to host.
+func (t *TLSOptions) clientConfig(host string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		NextProtos:         t.ALPN,
+		InsecureSkipVerify: !t.Verify,
+	}
+
+	// crypto/tls skips SNI for IP literals but still verifies them against IP SANs.
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	if t.CAFile != "" {
+		pool, err := loadCertPool(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// serverConfig builds the listener configuration, generating a certificate when none is given.
+func (t *TLSOptions) serverConfig(verbose bool) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	if t.CertFile != "" {
+		cert, err = tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load server certificate: %w", err)
+		}
+	} else {
+		cert, err = selfSignedCertificate()
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate certificate: %w", err)
+		}
+		if verbose {
+			sum := sha256.Sum256(cert.Certificate[0])
+			fmt.Fprintf(os.Stderr, "generated temporary self-signed certificate, SHA-256 fingerprint %X\n", sum)
+		}
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   t.ALPN,
+	}
+
+	if t.ClientCAFile != "" {
+		pool, err := loadCertPool(t.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(t.AllowedPeers) > 0 {
+		allowed := t.AllowedPeers
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("client certificate required")
+			}
+			leaf := state.PeerCertificates[0]
+			if !certAllowed(leaf, allowed) {
+				return fmt.Errorf("client certificate %s is not allowed", certIdentity(leaf))
+			}
+			return nil
+		}
+	}
+
+	return cfg, nil
+}
+
+// certNames lists the subject and every subject alternative name of cert.
+func certNames(cert *x509.Certificate) []string {
+	names := []string{cert.Subject.String()}
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	return names
+}
+
+// certAllowed reports whether any name on cert matches an allowlist entry.
+func certAllowed(cert *x509.Certificate, allowed []string) bool {
+	for _, name := range certNames(cert) {
+		for _, entry := range allowed {
+			if strings.EqualFold(name, entry) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// certIdentity formats the subject and SANs of cert for log output.
+func certIdentity(cert *x509.Certificate) string {
+	var sans []string
+	for _, name := range cert.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+
+	if len(sans) == 0 {
+		return cert.Subject.String()
+	}
+	return cert.Subject.String() + " [" + strings.Join(sans, ", ") + "]"
+}
+
+// peerIdentity returns the verified client certificate identity of conn, if any.
+func peerIdentity(conn net.Conn) string {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+
+	return certIdentity(certs[0])
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
+
+// selfSignedCertificate creates an in-memory ECDSA certificate for localhost and this host.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	names := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		names = append(names, hostname)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: names[len(names)-1]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     names,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// tlsClient performs the client handshake over conn.
+func tlsClient(ctx context.Context, conn net.Conn, host string, opts *TLSOptions, verbose bool) (net.Conn, error) {
+	cfg, err := opts.clientConfig(host)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("tls handshake failed: %w", err)
+	}
+
+	if verbose {
+		printTLSState(tlsConn.ConnectionState())
+	}
+
+	return tlsConn, nil
+}
+
+// tlsServer performs the server handshake over an accepted connection. A
+// client that does not finish it within timeout is dropped, so it cannot hold
+// up the listener.
+func tlsServer(conn net.Conn, cfg *tls.Config, timeout time.Duration, verbose bool) (*tls.Conn, error) {
+	if timeout <= 0 {
+		timeout = tlsHandshakeTimeout
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	tlsConn := tls.Server(conn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls handshake failed: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if verbose {
+		printTLSState(tlsConn.ConnectionState())
+	}
+
+	return tlsConn, nil
+}
+
+func printTLSState(state tls.ConnectionState) {
+	details := []string{tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)}
+	if state.NegotiatedProtocol != "" {
+		details = append(details, "ALPN "+state.NegotiatedProtocol)
+	}
+	fmt.Fprintf(os.Stderr, "TLS established: %s\n", strings.Join(details, ", "))
+}
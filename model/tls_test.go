@@ -0,0 +1,311 @@
+package model
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertAllowed(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://internal/ci")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "alice", Organization: []string{"Internal"}},
+		DNSNames:       []string{"alice.internal"},
+		EmailAddresses: []string{"alice@internal"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.7")},
+		URIs:           []*url.URL{spiffe},
+	}
+
+	tests := []struct {
+		entry string
+		want  bool
+	}{
+		{"alice", true},
+		{"CN=alice,O=Internal", true},
+		{"ALICE.internal", true},
+		{"alice@internal", true},
+		{"10.0.0.7", true},
+		{"spiffe://internal/ci", true},
+		{"bob", false},
+		{"Internal", false},
+	}
+
+	for _, tt := range tests {
+		if got := certAllowed(cert, []string{tt.entry}); got != tt.want {
+			t.Errorf("certAllowed(%q)=%v, want %v", tt.entry, got, tt.want)
+		}
+	}
+
+	want := "CN=alice,O=Internal [DNS:alice.internal, email:alice@internal, IP:10.0.0.7, URI:spiffe://internal/ci]"
+	if got := certIdentity(cert); got != want {
+		t.Errorf("certIdentity=%q, want %q", got, want)
+	}
+}
+
+// tlsPair runs the server and client handshakes over a loopback connection and
+// returns the client connection and the result of each side.
+func tlsPair(t *testing.T, server *tls.Config, client *TLSOptions, host string) (net.Conn, error, error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		tlsConn, err := tlsServer(conn, server, 5*time.Second, false)
+		if err != nil {
+			conn.Close()
+			serverErr <- err
+			return
+		}
+		// Echo one message so the client can see the session works.
+		buf := make([]byte, 64)
+		n, _ := tlsConn.Read(buf)
+		_, _ = tlsConn.Write(buf[:n])
+		tlsConn.Close()
+		serverErr <- nil
+	}()
+
+	raw, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { raw.Close() })
+	_ = raw.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn, clientErr := tlsClient(context.Background(), raw, host, client, false)
+	if clientErr == nil {
+		// With TLS 1.3 the client learns that its certificate was refused
+		// only when it next reads.
+		if _, err := io.WriteString(conn, "ping"); err == nil {
+			buf := make([]byte, 4)
+			_, clientErr = io.ReadFull(conn, buf)
+		}
+	}
+
+	return conn, clientErr, <-serverErr
+}
+
+// writePEM stores der as a PEM block of the given type in dir/name.
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testCA is a throwaway certificate authority for mTLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	path string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, path: writePEM(t, dir, "ca.pem", "CERTIFICATE", der)}
+}
+
+// issueClient signs a client certificate for cn and returns its cert and key files.
+func (ca *testCA) issueClient(t *testing.T, dir, cn string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writePEM(t, dir, cn+".pem", "CERTIFICATE", der), writePEM(t, dir, cn+".key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	for _, name := range []string{"localhost", "127.0.0.1", "::1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: pool}); err != nil {
+			t.Errorf("certificate not valid for %s: %v", name, err)
+		}
+	}
+}
+
+func TestTLSLoopback(t *testing.T) {
+	server, err := (&TLSOptions{ALPN: []string{"h2", "http/1.1"}}).serverConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Trust the generated certificate so the client can verify it.
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "server.pem", "CERTIFICATE", server.Certificates[0].Certificate[0])
+
+	tests := []struct {
+		name     string
+		client   TLSOptions
+		host     string
+		wantALPN string
+		wantErr  bool
+	}{
+		{name: "unverified", client: TLSOptions{}, host: "127.0.0.1"},
+		{name: "verified", client: TLSOptions{Verify: true, CAFile: caFile}, host: "localhost"},
+		{name: "wrong name", client: TLSOptions{Verify: true, CAFile: caFile}, host: "example.com", wantErr: true},
+		{name: "untrusted", client: TLSOptions{Verify: true}, host: "localhost", wantErr: true},
+		{name: "alpn", client: TLSOptions{ALPN: []string{"http/1.1"}}, host: "localhost", wantALPN: "http/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, clientErr, serverErr := tlsPair(t, server, &tt.client, tt.host)
+			if tt.wantErr {
+				if clientErr == nil {
+					t.Error("handshake should fail")
+				}
+				return
+			}
+			if clientErr != nil || serverErr != nil {
+				t.Fatalf("client: %v, server: %v", clientErr, serverErr)
+			}
+			if got := conn.(*tls.Conn).ConnectionState().NegotiatedProtocol; got != tt.wantALPN {
+				t.Errorf("ALPN = %q, want %q", got, tt.wantALPN)
+			}
+		})
+	}
+}
+
+func TestTLSClientAllowlist(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	aliceCert, aliceKey := ca.issueClient(t, dir, "alice")
+	bobCert, bobKey := ca.issueClient(t, dir, "bob")
+
+	server, err := (&TLSOptions{ClientCAFile: ca.path, AllowedPeers: []string{"alice"}}).serverConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		client  TLSOptions
+		wantErr string
+	}{
+		{name: "allowed", client: TLSOptions{CertFile: aliceCert, KeyFile: aliceKey}},
+		{name: "not allowed", client: TLSOptions{CertFile: bobCert, KeyFile: bobKey}, wantErr: "CN=bob is not allowed"},
+		{name: "no certificate", client: TLSOptions{}, wantErr: "certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, clientErr, serverErr := tlsPair(t, server, &tt.client, "localhost")
+			if tt.wantErr == "" {
+				if clientErr != nil || serverErr != nil {
+					t.Fatalf("client: %v, server: %v", clientErr, serverErr)
+				}
+				return
+			}
+			if serverErr == nil || !strings.Contains(serverErr.Error(), tt.wantErr) {
+				t.Errorf("server error = %v, want %q", serverErr, tt.wantErr)
+			}
+			if clientErr == nil {
+				t.Error("client should see the handshake fail")
+			}
+		})
+	}
+}
+
+func TestTLSServerHandshakeTimeout(t *testing.T) {
+	server, err := (&TLSOptions{}).serverConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, conn := net.Pipe()
+	defer client.Close()
+
+	// The client connects and never says anything.
+	done := make(chan error, 1)
+	go func() {
+		_, err := tlsServer(conn, server, 100*time.Millisecond, false)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("handshake with a silent client should fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handshake did not time out")
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// transferMagic starts the header line of the --send/--recv protocol.
+//
+// The sender writes "NCXFER1 {json header}\n". The receiver answers with
+// "OFFSET n\n", the number of bytes it already holds from an earlier attempt,
+// and the sender streams the rest of the file from there. Once the receiver has
+// checked the SHA-256 of the whole file it answers "OK\n" or "ERR reason\n".
+const transferMagic = "NCXFER1"
+
+type transferHeader struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// transferring reports whether connections carry a file or directory transfer.
+func (o Options) transferring() bool {
+	return o.SendFile != "" || o.RecvDir != "" || o.SendDir != "" || o.ExtractDir != ""
+}
+
+// runTransfer sends or receives one file or directory over conn and closes it.
+func (o Options) runTransfer(conn net.Conn) error {
+	defer conn.Close()
+
+	switch {
+	case o.SendFile != "":
+		return sendFile(conn, o.SendFile)
+	case o.RecvDir != "":
+		return recvFile(conn, o.RecvDir)
+	case o.SendDir != "":
+		return sendDir(conn, o.SendDir, o.Compression)
+	default:
+		return recvDir(conn, o.ExtractDir)
+	}
+}
+
+// sendFile offers the file at path to the peer and streams it from the offset the peer asks for.
+func sendFile(conn net.Conn, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, f); err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(transferHeader{
+		Name:   filepath.Base(path),
+		Size:   info.Size(),
+		SHA256: hex.EncodeToString(digest.Sum(nil)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "%s %s\n", transferMagic, header); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	reply, err := readTransferLine(r)
+	if err != nil {
+		return err
+	}
+	offsetStr, ok := strings.CutPrefix(reply, "OFFSET ")
+	if !ok {
+		return fmt.Errorf("receiver refused transfer: %s", reply)
+	}
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil || offset < 0 || offset > info.Size() {
+		return fmt.Errorf("receiver sent invalid offset %q", offsetStr)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		fmt.Fprintf(os.Stderr, "resuming %s at %s\n", info.Name(), formatBytes(offset))
+	}
+	bar := startProgress(os.Stderr, "sending "+info.Name(), info.Size(), offset)
+	_, err = io.Copy(conn, io.TeeReader(f, bar))
+	bar.finish()
+	if err != nil {
+		return err
+	}
+
+	status, err := readTransferLine(r)
+	if err != nil {
+		return fmt.Errorf("no confirmation from receiver: %w", err)
+	}
+	if status != "OK" {
+		return fmt.Errorf("receiver rejected %s: %s", info.Name(), strings.TrimPrefix(status, "ERR "))
+	}
+
+	return nil
+}
+
+// recvFile accepts one file into dir, resuming a partial download when possible.
+func recvFile(conn net.Conn, dir string) error {
+	r := bufio.NewReader(conn)
+
+	line, err := readTransferLine(r)
+	if err != nil {
+		return err
+	}
+	payload, ok := strings.CutPrefix(line, transferMagic+" ")
+	if !ok {
+		return errors.New("peer is not sending a file")
+	}
+
+	var header transferHeader
+	if err := json.Unmarshal([]byte(payload), &header); err != nil {
+		return fmt.Errorf("invalid transfer header: %w", err)
+	}
+
+	name := filepath.Base(header.Name)
+	if name != header.Name || name == "." || name == ".." || name == string(filepath.Separator) {
+		fmt.Fprintf(conn, "ERR invalid file name\n")
+		return fmt.Errorf("refusing file name %q", header.Name)
+	}
+	// The digest ends up in a file name, so it must be exactly a SHA-256 in hex.
+	want, err := hex.DecodeString(header.SHA256)
+	if err != nil || len(want) != sha256.Size || header.Size < 0 {
+		fmt.Fprintf(conn, "ERR invalid header\n")
+		return errors.New("invalid transfer header")
+	}
+	wantHex := hex.EncodeToString(want)
+
+	// The partial file is keyed by digest, so only the same content is ever resumed.
+	final := filepath.Join(dir, name)
+	partial := filepath.Join(dir, "."+name+"."+wantHex[:16]+".part")
+
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		fmt.Fprintf(conn, "ERR cannot create file\n")
+		return err
+	}
+	defer f.Close()
+
+	digest := sha256.New()
+	offset, err := io.Copy(digest, f)
+	if err != nil {
+		return err
+	}
+	if offset > header.Size {
+		// Stale partial file; start over.
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		digest.Reset()
+		offset = 0
+	}
+
+	if _, err := fmt.Fprintf(conn, "OFFSET %d\n", offset); err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		fmt.Fprintf(os.Stderr, "resuming %s at %s\n", name, formatBytes(offset))
+	}
+	bar := startProgress(os.Stderr, "receiving "+name, header.Size, offset)
+	n, err := io.CopyN(io.MultiWriter(f, digest, bar), r, header.Size-offset)
+	bar.finish()
+	if err != nil {
+		// Keep what arrived so the next attempt can resume from it.
+		return fmt.Errorf("transfer interrupted after %s: %w", formatBytes(offset+n), err)
+	}
+
+	if got := digest.Sum(nil); !bytes.Equal(got, want) {
+		_ = os.Remove(partial)
+		fmt.Fprintf(conn, "ERR sha256 mismatch\n")
+		return fmt.Errorf("sha256 mismatch for %s: got %x, want %s", name, got, wantHex)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partial, final); err != nil {
+		fmt.Fprintf(conn, "ERR cannot store file\n")
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "received %s (%s, sha256 %s)\n", final, formatBytes(header.Size), wantHex)
+	_, err = fmt.Fprintf(conn, "OK\n")
+	return err
+}
+
+// readTransferLine reads one protocol line without its line ending.
+func readTransferLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileTransferResume(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	data := bytes.Repeat([]byte("netcat transfer "), 4096)
+	path := filepath.Join(src, "payload.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave half of the file behind as if an earlier attempt was interrupted.
+	sum := sha256.Sum256(data)
+	partial := filepath.Join(dst, ".payload.bin."+hex.EncodeToString(sum[:])[:16]+".part")
+	if err := os.WriteFile(partial, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sender, receiver := net.Pipe()
+	sent := make(chan error, 1)
+	go func() {
+		sent <- Options{SendFile: path}.runTransfer(sender)
+	}()
+
+	if err := (Options{RecvDir: dst}).runTransfer(receiver); err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dst, "payload.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("received file differs from the original")
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Error("partial file was not renamed into place")
+	}
+}
+
+func TestRecvFileRejectsBadDigest(t *testing.T) {
+	base := t.TempDir()
+	dst := filepath.Join(base, "a", "b", "recv")
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	digests := []string{
+		// Hex-length, but the prefix used in the partial name walks out of dst.
+		"/../../../../zz" + strings.Repeat("0", 64-len("/../../../../zz")),
+		strings.Repeat("g", 64),
+		strings.Repeat("ab", 16),
+	}
+
+	for _, digest := range digests {
+		sender, receiver := net.Pipe()
+		go func() {
+			defer sender.Close()
+			fmt.Fprintf(sender, "%s {\"name\":\"f\",\"size\":4,\"sha256\":%q}\n", transferMagic, digest)
+			reply, _ := bufio.NewReader(sender).ReadString('\n')
+			if !strings.HasPrefix(reply, "ERR ") {
+				t.Errorf("digest %q: receiver replied %q", digest, reply)
+			}
+		}()
+
+		if err := recvFile(receiver, dst); err == nil {
+			t.Errorf("digest %q was accepted", digest)
+		}
+		receiver.Close()
+	}
+
+	// Nothing may be created anywhere under base besides the receive directory itself.
+	err := filepath.WalkDir(base, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Errorf("unexpected file %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
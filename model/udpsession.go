@@ -0,0 +1,151 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// udpSession presents one remote peer of a shared UDP or Unix datagram
+// listening socket as a net.Conn, so datagram peers can be served like accepted
+// TCP connections. Incoming datagrams are delivered by the listener; writes go
+// straight to the peer.
+type udpSession struct {
+	pc   net.PacketConn
+	peer net.Addr
+	// connected is set when pc has been connected to peer, which then takes
+	// plain writes: some systems refuse sendto with an address on such sockets.
+	connected bool
+
+	in      chan []byte
+	pending []byte
+	done    chan struct{}
+
+	closeOnce sync.Once
+	onClose   func()
+
+	idle      time.Duration
+	idleTimer *time.Timer
+
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+// udpSessionBacklog is how many datagrams may queue for a session before new ones are dropped.
+const udpSessionBacklog = 64
+
+func newUDPSession(pc net.PacketConn, peer net.Addr, idle time.Duration, onClose func()) *udpSession {
+	s := &udpSession{
+		pc:      pc,
+		peer:    peer,
+		in:      make(chan []byte, udpSessionBacklog),
+		done:    make(chan struct{}),
+		onClose: onClose,
+		idle:    idle,
+	}
+	if idle > 0 {
+		s.idleTimer = time.AfterFunc(idle, func() { _ = s.Close() })
+	}
+	return s
+}
+
+// deliver queues a datagram received from the peer. It never blocks the
+// listener: when the session falls behind, the datagram is dropped.
+func (s *udpSession) deliver(p []byte) {
+	s.touch()
+
+	select {
+	case s.in <- p:
+	case <-s.done:
+	default:
+	}
+}
+
+// touch postpones the idle timeout after activity in either direction.
+func (s *udpSession) touch() {
+	if s.idleTimer != nil {
+		s.idleTimer.Reset(s.idle)
+	}
+}
+
+func (s *udpSession) Read(p []byte) (int, error) {
+	// Hand out the rest of a datagram larger than the previous read buffer.
+	if len(s.pending) > 0 {
+		n := copy(p, s.pending)
+		s.pending = s.pending[n:]
+		return n, nil
+	}
+
+	var timeout <-chan time.Time
+	s.mu.Lock()
+	deadline := s.readDeadline
+	s.mu.Unlock()
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case datagram := <-s.in:
+		n := copy(p, datagram)
+		s.pending = datagram[n:]
+		return n, nil
+	case <-s.done:
+		return 0, io.EOF
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (s *udpSession) Write(p []byte) (int, error) {
+	select {
+	case <-s.done:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	s.touch()
+	if s.connected {
+		return s.pc.(net.Conn).Write(p)
+	}
+	return s.pc.WriteTo(p, s.peer)
+}
+
+// Close ends the session; the shared listening socket stays open.
+func (s *udpSession) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.idleTimer != nil {
+			s.idleTimer.Stop()
+		}
+		if s.onClose != nil {
+			s.onClose()
+		}
+	})
+	return nil
+}
+
+func (s *udpSession) LocalAddr() net.Addr  { return s.pc.LocalAddr() }
+func (s *udpSession) RemoteAddr() net.Addr { return s.peer }
+
+func (s *udpSession) SetDeadline(t time.Time) error {
+	return s.SetReadDeadline(t)
+}
+
+func (s *udpSession) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.readDeadline = t
+	s.mu.Unlock()
+	return nil
+}
+
+// SetWriteDeadline is a no-op: datagram writes never block on the peer.
+func (s *udpSession) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2025 zihaofu245 <zihaofu12@gmail.com>
+*/
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UnixSocket describes a Unix domain socket endpoint.
+type UnixSocket struct {
+	// Path is a filesystem path, or a Linux abstract socket name starting with "@".
+	Path string
+	// Type is the socket network: "unix", "unixgram" or "unixpacket".
+	Type string
+	// Mode sets the permissions of the socket file in listen mode; zero keeps the umask default.
+	Mode os.FileMode
+}
+
+func (u *UnixSocket) abstract() bool {
+	return strings.HasPrefix(u.Path, "@")
+}
+
+// listenUnix serves a Unix domain socket, reusing the TCP accept loop for
+// stream and seqpacket sockets.
+func listenUnix(cfg listenConfig) error {
+	sock := cfg.opts.Unix
+
+	if err := removeStaleSocket(sock); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Listening on %s (%s)\n", sock.Path, sock.Type)
+
+	if sock.Type == "unixgram" {
+		return listenUnixgram(cfg)
+	}
+
+	ln, err := net.Listen(sock.Type, sock.Path)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	if err := chmodSocket(sock); err != nil {
+		return err
+	}
+
+	return cfg.acceptLoop(ln)
+}
+
+// listenUnixgram serves datagram peers through the same per-peer sessions as
+// the UDP listener. Only peers that bound a name of their own can get replies.
+func listenUnixgram(cfg listenConfig) error {
+	sock := cfg.opts.Unix
+
+	conn, err := net.ListenUnixgram(sock.Type, &net.UnixAddr{Name: sock.Path, Net: sock.Type})
+	if err != nil {
+		return err
+	}
+	if !sock.abstract() {
+		defer os.Remove(sock.Path)
+	}
+
+	if err := chmodSocket(sock); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	return cfg.servePackets(conn)
+}
+
+// removeStaleSocket deletes a leftover socket file that nobody is listening on.
+// Regular files and sockets that still accept connections are left alone.
+func removeStaleSocket(sock *UnixSocket) error {
+	if sock.abstract() {
+		return nil
+	}
+
+	info, err := os.Lstat(sock.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", sock.Path)
+	}
+
+	if conn, err := net.DialTimeout(sock.Type, sock.Path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is in use by another process", sock.Path)
+	}
+
+	return os.Remove(sock.Path)
+}
+
+func chmodSocket(sock *UnixSocket) error {
+	if sock.Mode == 0 || sock.abstract() {
+		return nil
+	}
+
+	if err := os.Chmod(sock.Path, sock.Mode); err != nil {
+		return fmt.Errorf("cannot set socket permissions: %w", err)
+	}
+
+	return nil
+}
+
+// unixgramDialer binds a temporary local name for datagram clients, so that
+// the peer has somewhere to send replies. The name lives in a private
+// directory that other users cannot create it in ahead of us.
+type unixgramDialer struct {
+	dir   string
+	laddr *net.UnixAddr
+}
+
+func newUnixgramDialer() (*unixgramDialer, error) {
+	dir, err := os.MkdirTemp("", "nc-")
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Join(dir, "client.sock")
+	return &unixgramDialer{dir: dir, laddr: &net.UnixAddr{Name: name, Net: "unixgram"}}, nil
+}
+
+// DialContext dials address, clearing the local name left behind by a failed attempt.
+func (d *unixgramDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	_ = os.Remove(d.laddr.Name)
+
+	dialer := net.Dialer{LocalAddr: d.laddr}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// cleanup removes the temporary directory and the socket in it.
+func (d *unixgramDialer) cleanup() {
+	_ = os.RemoveAll(d.dir)
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixgramDialerPrivateName(t *testing.T) {
+	d, err := newUnixgramDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Dir(d.laddr.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Errorf("socket directory mode = %v, want 0700", perm)
+	}
+
+	server := filepath.Join(t.TempDir(), "server.sock")
+	pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: server, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	conn, err := d.DialContext(context.Background(), "unixgram", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The listener can answer because the client is bound to its private name.
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	_ = pc.SetDeadline(time.Now().Add(2 * time.Second))
+	n, from, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "ping" || from.String() != d.laddr.Name {
+		t.Fatalf("got %q from %v", buf[:n], from)
+	}
+	if _, err := pc.WriteTo([]byte("pong"), from); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "pong" {
+		t.Fatalf("reply %q, %v", buf[:n], err)
+	}
+
+	d.cleanup()
+	if _, err := os.Stat(d.dir); !os.IsNotExist(err) {
+		t.Errorf("temporary directory left behind: %v", err)
+	}
+}